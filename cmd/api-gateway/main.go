@@ -11,6 +11,7 @@ import (
 	"real-time-chat-system/internal/discovery"
 	"real-time-chat-system/internal/gateway"
 	"real-time-chat-system/internal/health"
+	"real-time-chat-system/internal/identity"
 	"real-time-chat-system/internal/redis"
 	"syscall"
 	"time"
@@ -55,10 +56,11 @@ func main() {
 	healthChecker.SetVersion("1.0.0")
 
 	// Initialize API Gateway
-	gateway, err := gateway.New(&cfg.Gateway, serviceDiscovery, healthChecker, db, redisClient)
+	gateway, err := gateway.New(&cfg.Gateway, &cfg.Chat, &cfg.Presence, serviceDiscovery, healthChecker, db, redisClient, identity.NewSigner(&cfg.Identity))
 	if err != nil {
 		log.Fatalf("Failed to initialize API gateway: %v", err)
 	}
+	defer gateway.Close()
 
 	// Start server
 	server := &http.Server{
@@ -11,6 +11,7 @@ import (
 	"real-time-chat-system/internal/database"
 	"real-time-chat-system/internal/discovery"
 	"real-time-chat-system/internal/health"
+	"real-time-chat-system/internal/identity"
 	"real-time-chat-system/internal/redis"
 	"syscall"
 	"time"
@@ -48,7 +49,7 @@ func main() {
 	healthChecker.SetVersion("1.0.0")
 
 	// Initialize Call Service
-	callService, err := call.New(&cfg.Call, healthChecker, db, redisClient)
+	callService, err := call.New(&cfg.Call, healthChecker, db, redisClient, identity.NewSigner(&cfg.Identity))
 	if err != nil {
 		log.Fatalf("Failed to initialize call service: %v", err)
 	}
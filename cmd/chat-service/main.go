@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"real-time-chat-system/internal/blob"
 	"real-time-chat-system/internal/chat"
 	"real-time-chat-system/internal/config"
 	"real-time-chat-system/internal/database"
 	"real-time-chat-system/internal/discovery"
 	"real-time-chat-system/internal/health"
+	"real-time-chat-system/internal/identity"
 	redisclient "real-time-chat-system/internal/redis"
 	"syscall"
 	"time"
@@ -47,12 +49,39 @@ func main() {
 	healthChecker := health.NewChecker()
 	healthChecker.SetVersion("1.0.0")
 
+	// Initialize attachment storage
+	blobStore, err := blob.New(&cfg.BlobStore)
+	if err != nil {
+		log.Fatalf("Failed to initialize blob store: %v", err)
+	}
+
 	// Initialize Chat Service
-	chatService, err := chat.New(&cfg.Chat, healthChecker, db, redisClient)
+	chatService, err := chat.New(&cfg.Chat, &cfg.Presence, healthChecker, db, redisClient, identity.NewSigner(&cfg.Identity), blobStore)
 	if err != nil {
 		log.Fatalf("Failed to initialize chat service: %v", err)
 	}
 
+	// Index memberships created before the per-user channel index existed.
+	// This only does work on the first start after upgrading, and runs in
+	// the background so it does not hold up startup.
+	go func() {
+		if err := chatService.RebuildUserChannelIndex(context.Background()); err != nil {
+			log.Printf("Failed to rebuild user channel index: %v", err)
+		}
+	}()
+
+	// Purge deleted message content once its grace period has passed
+	purgeCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	go chatService.RunTombstonePurger(purgeCtx)
+
+	// Generate image attachment previews in the background
+	previewCtx, stopPreviews := context.WithCancel(context.Background())
+	defer stopPreviews()
+	for i := 0; i < cfg.Chat.Attachments.GetPreviewWorkers(); i++ {
+		go chatService.RunPreviewWorker(previewCtx)
+	}
+
 	// Register service
 	if err := serviceDiscovery.Register("chat-service", cfg.Chat.Port); err != nil {
 		log.Fatalf("Failed to register service: %v", err)
@@ -9,6 +9,7 @@ import (
 	"real-time-chat-system/internal/config"
 	"real-time-chat-system/internal/discovery"
 	"real-time-chat-system/internal/health"
+	"real-time-chat-system/internal/identity"
 	"real-time-chat-system/internal/presence"
 	redisclient "real-time-chat-system/internal/redis"
 	"syscall"
@@ -40,11 +41,18 @@ func main() {
 	healthChecker.SetVersion("1.0.0")
 
 	// Initialize Presence Service
-	presenceService, err := presence.New(&cfg.Presence, healthChecker, redisClient)
+	presenceService, err := presence.New(&cfg.Presence, healthChecker, redisClient, identity.NewSigner(&cfg.Identity))
 	if err != nil {
 		log.Fatalf("Failed to initialize presence service: %v", err)
 	}
 
+	// Announce users whose presence expires without a further heartbeat and
+	// drop channel presence that gateways stopped refreshing
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go presenceService.RunExpirySweeper(sweepCtx)
+	go presenceService.RunChannelSweeper(sweepCtx)
+
 	// Register service
 	if err := serviceDiscovery.Register("presence-service", cfg.Presence.Port); err != nil {
 		log.Fatalf("Failed to register service: %v", err)
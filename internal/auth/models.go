@@ -0,0 +1,30 @@
+package auth
+
+import "real-time-chat-system/internal/chat"
+
+// RegisterRequest represents a request to create a user account
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginRequest represents a login with a username or email address
+type LoginRequest struct {
+	Login    string `json:"login" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// RefreshRequest represents a request to exchange or revoke a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenResponse represents an issued token pair
+type TokenResponse struct {
+	AccessToken  string     `json:"access_token"`
+	RefreshToken string     `json:"refresh_token"`
+	TokenType    string     `json:"token_type"`
+	ExpiresIn    int        `json:"expires_in"`
+	User         *chat.User `json:"user,omitempty"`
+}
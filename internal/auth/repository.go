@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"real-time-chat-system/internal/chat"
+	"real-time-chat-system/internal/database"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// uniqueViolation is the PostgreSQL error code for unique constraint violations
+const uniqueViolation = "23505"
+
+// Repository handles database operations for user accounts.
+//
+// Channels and messages reference users by foreign key, so every user row is
+// replicated to all shards. The first shard holds the authoritative copy and
+// enforces username and email uniqueness.
+type Repository struct {
+	db *database.PostgresDB
+}
+
+// NewRepository creates a new auth repository
+func NewRepository(db *database.PostgresDB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// directory returns the shard holding the authoritative user records
+func (r *Repository) directory() *pgxpool.Pool {
+	return r.db.Shards()[0]
+}
+
+// CreateUser inserts a new user and replicates it to every shard. If the
+// user cannot be replicated it is removed again, so registering can be
+// retried.
+func (r *Repository) CreateUser(ctx context.Context, username, email, passwordHash string) (*chat.User, error) {
+	query := `
+		INSERT INTO users (username, email, password_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING id, username, email, password_hash, created_at, updated_at
+	`
+
+	var user chat.User
+	err := r.directory().QueryRow(ctx, query, username, email, passwordHash).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			if pgErr.ConstraintName == "users_email_key" {
+				return nil, ErrEmailTaken
+			}
+			return nil, ErrUsernameTaken
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := r.replicateUser(ctx, &user); err != nil {
+		// Remove every copy so that registering again starts afresh rather
+		// than hitting the partial user's username or email
+		r.deleteUser(context.WithoutCancel(ctx), user.ID)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// replicationAttempts bounds how often copying a user to a shard is tried
+const replicationAttempts = 3
+
+// replicateUser copies a user from the directory to every other shard.
+// Copies that already exist are left alone, so a failed attempt can simply
+// be repeated.
+func (r *Repository) replicateUser(ctx context.Context, user *chat.User) error {
+	query := `
+		INSERT INTO users (id, username, email, password_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	for i, pool := range r.db.Shards()[1:] {
+		var err error
+		for attempt := 1; attempt <= replicationAttempts; attempt++ {
+			_, err = pool.Exec(ctx, query,
+				user.ID, user.Username, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt)
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to replicate user to shard %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteUser removes a user that has not been fully created from every
+// shard. Failures are logged; a copy left behind blocks the username and
+// email until removed by hand.
+func (r *Repository) deleteUser(ctx context.Context, userID string) {
+	for i, pool := range r.db.Shards() {
+		if _, err := pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID); err != nil {
+			log.Printf("Failed to remove partially created user %s from shard %d: %v", userID, i, err)
+		}
+	}
+}
+
+// UsernameOrEmailExists reports whether the username or email is already registered
+func (r *Repository) UsernameOrEmailExists(ctx context.Context, username, email string) (usernameTaken, emailTaken bool, err error) {
+	query := `
+		SELECT
+			EXISTS(SELECT 1 FROM users WHERE username = $1),
+			EXISTS(SELECT 1 FROM users WHERE lower(email) = lower($2))
+	`
+
+	err = r.directory().QueryRow(ctx, query, username, email).Scan(&usernameTaken, &emailTaken)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to check user uniqueness: %w", err)
+	}
+
+	return usernameTaken, emailTaken, nil
+}
+
+// GetUserByLogin retrieves a user by username or email address
+func (r *Repository) GetUserByLogin(ctx context.Context, login string) (*chat.User, error) {
+	query := `
+		SELECT id, username, email, password_hash, created_at, updated_at
+		FROM users
+		WHERE username = $1 OR lower(email) = lower($1)
+		LIMIT 1
+	`
+
+	return r.scanUser(r.directory().QueryRow(ctx, query, login))
+}
+
+// GetUser retrieves a user by ID
+func (r *Repository) GetUser(ctx context.Context, userID string) (*chat.User, error) {
+	query := `
+		SELECT id, username, email, password_hash, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`
+
+	return r.scanUser(r.directory().QueryRow(ctx, query, userID))
+}
+
+// scanUser scans a single user row
+func (r *Repository) scanUser(row pgx.Row) (*chat.User, error) {
+	var user chat.User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"real-time-chat-system/internal/config"
+	"real-time-chat-system/internal/database"
+	"real-time-chat-system/internal/health"
+	redisclient "real-time-chat-system/internal/redis"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUsernameTaken      = errors.New("username is already taken")
+	ErrEmailTaken         = errors.New("email is already registered")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	ErrInvalidToken       = errors.New("invalid refresh token")
+	ErrTokenRevoked       = errors.New("refresh token has been revoked")
+
+	// errInvalidInput marks request validation failures
+	errInvalidInput = errors.New("invalid input")
+)
+
+// usernamePattern restricts usernames to characters that are safe in mentions
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+// Password length bounds; bcrypt ignores input beyond 72 bytes
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// Service represents the authentication service
+type Service struct {
+	config        *config.AuthConfig
+	jwtSecret     []byte
+	healthChecker *health.Checker
+	db            *database.PostgresDB
+	redis         *redisclient.Client
+	repository    *Repository
+	// dummyHash is compared against when a login names an unknown user, so
+	// that lookups take the same time whether or not the user exists
+	dummyHash []byte
+}
+
+// New creates a new authentication service instance
+func New(cfg *config.AuthConfig, jwtSecret string, healthChecker *health.Checker, db *database.PostgresDB, redisClient *redisclient.Client) (*Service, error) {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare password hashing: %w", err)
+	}
+
+	service := &Service{
+		config:        cfg,
+		jwtSecret:     []byte(jwtSecret),
+		healthChecker: healthChecker,
+		db:            db,
+		redis:         redisClient,
+		repository:    NewRepository(db),
+		dummyHash:     dummyHash,
+	}
+
+	// Add health checks
+	healthChecker.AddCheck("database", health.DatabaseHealthCheck(db))
+	healthChecker.AddCheck("redis", health.RedisHealthCheck(redisClient))
+
+	return service, nil
+}
+
+// Register creates a new user account and issues its first token pair
+func (s *Service) Register(ctx context.Context, req RegisterRequest) (*TokenResponse, error) {
+	username := strings.TrimSpace(req.Username)
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("%w: username must be 3-32 letters, digits, '_', '.' or '-'", errInvalidInput)
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return nil, fmt.Errorf("%w: email address is invalid", errInvalidInput)
+	}
+	if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+		return nil, fmt.Errorf("%w: password must be %d-%d characters", errInvalidInput, minPasswordLength, maxPasswordLength)
+	}
+
+	usernameTaken, emailTaken, err := s.repository.UsernameOrEmailExists(ctx, username, email)
+	if err != nil {
+		return nil, err
+	}
+	if usernameTaken {
+		return nil, ErrUsernameTaken
+	}
+	if emailTaken {
+		return nil, ErrEmailTaken
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// The unique constraints still guard against concurrent registrations
+	user, err := s.repository.CreateUser(ctx, username, email, string(passwordHash))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	tokens.User = user
+
+	return tokens, nil
+}
+
+// Login verifies a user's credentials and issues a token pair
+func (s *Service) Login(ctx context.Context, req LoginRequest) (*TokenResponse, error) {
+	user, err := s.repository.GetUserByLogin(ctx, strings.TrimSpace(req.Login))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			bcrypt.CompareHashAndPassword(s.dummyHash, []byte(req.Password))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	tokens, err := s.issueTokens(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	tokens.User = user
+
+	return tokens, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented
+// refresh token is revoked, so each one can be used only once.
+func (s *Service) Refresh(ctx context.Context, req RefreshRequest) (*TokenResponse, error) {
+	claims, err := s.parseRefreshToken(req.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.consumeRefreshToken(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, claims.Subject)
+}
+
+// Logout revokes a refresh token
+func (s *Service) Logout(ctx context.Context, req RefreshRequest) error {
+	claims, err := s.parseRefreshToken(req.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.redis.Del(ctx, refreshTokenKey(claims.ID)); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// Router returns the HTTP router for the auth service
+func (s *Service) Router() http.Handler {
+	gin.SetMode(gin.ReleaseMode)
+
+	router := gin.New()
+	router.Use(gin.Logger())
+	router.Use(gin.Recovery())
+
+	// Health endpoints
+	router.GET("/health", gin.WrapF(s.healthChecker.Handler()))
+	router.GET("/health/ready", gin.WrapF(s.healthChecker.ReadinessHandler()))
+	router.GET("/health/live", gin.WrapF(health.LivenessHandler()))
+
+	// Metrics endpoint for Prometheus
+	router.GET("/metrics", s.metricsHandler)
+
+	// Service endpoints
+	v1 := router.Group("/v1/auth")
+	{
+		v1.POST("/register", s.registerHandler)
+		v1.POST("/login", s.loginHandler)
+		v1.POST("/refresh", s.refreshHandler)
+		v1.POST("/logout", s.logoutHandler)
+	}
+
+	return router
+}
+
+// registerHandler handles account registration
+func (s *Service) registerHandler(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := s.Register(c.Request.Context(), req)
+	if err != nil {
+		s.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tokens)
+}
+
+// loginHandler handles password logins
+func (s *Service) loginHandler(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := s.Login(c.Request.Context(), req)
+	if err != nil {
+		s.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// refreshHandler handles refresh token exchanges
+func (s *Service) refreshHandler(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := s.Refresh(c.Request.Context(), req)
+	if err != nil {
+		s.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// logoutHandler handles refresh token revocation
+func (s *Service) logoutHandler(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.Logout(c.Request.Context(), req); err != nil {
+		s.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "logged out"})
+}
+
+// writeError maps service errors to HTTP responses
+func (s *Service) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenRevoked):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// metricsHandler exposes Prometheus metrics
+func (s *Service) metricsHandler(c *gin.Context) {
+	c.String(http.StatusOK, "# Prometheus metrics would be exposed here\n")
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"real-time-chat-system/internal/identity"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// refreshTokenKey returns the Redis key recording a live refresh token
+func refreshTokenKey(tokenID string) string {
+	return fmt.Sprintf("auth:refresh:%s", tokenID)
+}
+
+// newTokenID generates a random JWT ID
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// issueTokens signs a new access and refresh token pair for the user and
+// records the refresh token in Redis so it can be revoked
+func (s *Service) issueTokens(ctx context.Context, userID string) (*TokenResponse, error) {
+	now := time.Now()
+	accessTTL := s.config.GetAccessTokenTTL()
+	refreshTTL := s.config.GetRefreshTokenTTL()
+
+	accessID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.signToken(identity.TokenTypeAccess, userID, accessID, now, accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := s.signToken(identity.TokenTypeRefresh, userID, refreshID, now, refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.redis.Set(ctx, refreshTokenKey(refreshID), userID, refreshTTL); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTTL.Seconds()),
+	}, nil
+}
+
+// signToken signs a single HS256 token
+func (s *Service) signToken(tokenType, userID, tokenID string, issuedAt time.Time, ttl time.Duration) (string, error) {
+	claims := identity.Claims{
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.config.Issuer,
+			Subject:   userID,
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			NotBefore: jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(ttl)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.jwtSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return token, nil
+}
+
+// parseRefreshToken validates a refresh token's signature, expiry and type
+func (s *Service) parseRefreshToken(tokenString string) (*identity.Claims, error) {
+	claims := &identity.Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.jwtSecret, nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.TokenType != identity.TokenTypeRefresh || claims.Subject == "" || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// consumeRefreshToken atomically removes a refresh token from Redis, so each
+// token can be exchanged at most once
+func (s *Service) consumeRefreshToken(ctx context.Context, claims *identity.Claims) error {
+	userID, err := s.redis.GetDel(ctx, refreshTokenKey(claims.ID))
+	if err != nil {
+		if err == goredis.Nil {
+			return ErrTokenRevoked
+		}
+		return fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	if userID != claims.Subject {
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package blob
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"attachments/2024/01/file.png", true},
+		{"file.png", true},
+		{"a/..b/c", true},
+
+		{"", false},
+		{"/etc/passwd", false},
+		{"..", false},
+		{"../secret", false},
+		{"attachments/../../secret", false},
+		{"attachments/..", false},
+		{"./file.png", false},
+		{"attachments//file.png", false},
+		{"attachments/", false},
+		{"attachments\\file.png", false},
+		{"..\\secret", false},
+	}
+
+	for _, tt := range tests {
+		err := validateKey(tt.key)
+		if tt.valid && err != nil {
+			t.Errorf("validateKey(%q) = %v, want nil", tt.key, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("validateKey(%q) = %v, want ErrInvalidKey", tt.key, err)
+		}
+	}
+}
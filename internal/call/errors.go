@@ -0,0 +1,33 @@
+package call
+
+import (
+	"errors"
+	"net/http"
+	"real-time-chat-system/internal/chat"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrCallNotFound   = errors.New("call not found")
+	ErrCallInProgress = errors.New("channel already has a call in progress")
+	ErrCallEnded      = errors.New("call has ended")
+	ErrNotInCall      = errors.New("user is not in the call")
+	ErrInvalidType    = errors.New("call type must be audio or video")
+)
+
+// writeError maps service errors to HTTP responses
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrCallNotFound), errors.Is(err, chat.ErrChannelNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, chat.ErrNotChannelMember), errors.Is(err, chat.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrCallInProgress), errors.Is(err, ErrCallEnded), errors.Is(err, ErrNotInCall):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,65 @@
+package call
+
+import "time"
+
+// Call statuses
+const (
+	StatusActive = "active"
+	StatusEnded  = "ended"
+)
+
+// Call types
+const (
+	TypeAudio = "audio"
+	TypeVideo = "video"
+)
+
+// Participant signalling states. Signalling moves a participant on from
+// joining; leaving, or the call ending, moves them to left.
+const (
+	SignallingJoining = "joining"
+	SignallingLeft    = "left"
+)
+
+// WebSocket event types published on the call's channel topic
+const (
+	EventCallStarted = "call_started"
+	EventCallJoined  = "call_participant_joined"
+	EventCallLeft    = "call_participant_left"
+	EventCallEnded   = "call_ended"
+)
+
+// Session represents a call in a channel
+type Session struct {
+	ID           string        `json:"id" db:"id"`
+	ChannelID    string        `json:"channel_id" db:"channel_id"`
+	CreatedBy    string        `json:"created_by" db:"created_by"`
+	Status       string        `json:"status" db:"status"`
+	CallType     string        `json:"call_type" db:"call_type"`
+	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
+	EndedAt      *time.Time    `json:"ended_at,omitempty" db:"ended_at"`
+	Participants []Participant `json:"participants"`
+}
+
+// Participant represents a user's attendance of a call. A user who leaves
+// and rejoins keeps one record, with joined_at moved to the latest join.
+type Participant struct {
+	CallID          string     `json:"call_id" db:"call_id"`
+	UserID          string     `json:"user_id" db:"user_id"`
+	JoinedAt        time.Time  `json:"joined_at" db:"joined_at"`
+	LeftAt          *time.Time `json:"left_at,omitempty" db:"left_at"`
+	SignallingState string     `json:"signalling_state" db:"signalling_state"`
+}
+
+// CreateCallRequest represents a request to start a call in a channel
+type CreateCallRequest struct {
+	ChannelID string `json:"channel_id" binding:"required"`
+	CallType  string `json:"call_type"` // audio (default) or video
+}
+
+// ParticipantEvent represents a participant joining or leaving a call
+type ParticipantEvent struct {
+	CallID      string      `json:"call_id"`
+	ChannelID   string      `json:"channel_id"`
+	Participant Participant `json:"participant"`
+}
@@ -0,0 +1,347 @@
+package call
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"real-time-chat-system/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the PostgreSQL error code for unique constraint violations
+const uniqueViolation = "23505"
+
+// Repository handles database operations for calls. Calls live on the shard
+// of their channel.
+type Repository struct {
+	db *database.PostgresDB
+}
+
+// NewRepository creates a new call repository
+func NewRepository(db *database.PostgresDB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// sessionColumns lists the call_sessions columns read by scanSession, in order
+const sessionColumns = `id, channel_id, created_by, status, call_type, created_at, ended_at`
+
+// scanSession scans a row selected with sessionColumns
+func scanSession(row pgx.Row) (*Session, error) {
+	var session Session
+	err := row.Scan(
+		&session.ID,
+		&session.ChannelID,
+		&session.CreatedBy,
+		&session.Status,
+		&session.CallType,
+		&session.CreatedAt,
+		&session.EndedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// participantColumns lists the call_participants columns read by
+// scanParticipant, in order
+const participantColumns = `call_id, user_id, joined_at, left_at, signalling_state`
+
+// scanParticipant scans a row selected with participantColumns
+func scanParticipant(row pgx.Row) (*Participant, error) {
+	var participant Participant
+	err := row.Scan(
+		&participant.CallID,
+		&participant.UserID,
+		&participant.JoinedAt,
+		&participant.LeftAt,
+		&participant.SignallingState,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &participant, nil
+}
+
+// CreateCall starts a call in a channel with its creator as the first
+// participant. A channel has at most one active call.
+func (r *Repository) CreateCall(ctx context.Context, channelID, userID, callType string) (*Session, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO call_sessions (channel_id, created_by, status, call_type, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING ` + sessionColumns
+	session, err := scanSession(tx.QueryRow(ctx, query, channelID, userID, StatusActive, callType))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, ErrCallInProgress
+		}
+		return nil, fmt.Errorf("failed to create call: %w", err)
+	}
+
+	participant, err := upsertParticipant(ctx, tx, session.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	session.Participants = []Participant{*participant}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit call: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetCall returns a call with all of its participants. The call ID does not
+// name its shard, so every shard is searched.
+func (r *Repository) GetCall(ctx context.Context, callID string) (*Session, error) {
+	if _, err := uuid.Parse(callID); err != nil {
+		return nil, ErrCallNotFound
+	}
+
+	query := `SELECT ` + sessionColumns + ` FROM call_sessions WHERE id = $1`
+	for i, pool := range r.db.Shards() {
+		session, err := scanSession(pool.QueryRow(ctx, query, callID))
+		if err == pgx.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get call on shard %d: %w", i, err)
+		}
+
+		session.Participants, err = listParticipants(ctx, pool, session.ID)
+		if err != nil {
+			return nil, err
+		}
+		return session, nil
+	}
+
+	return nil, ErrCallNotFound
+}
+
+// GetActiveCall returns the active call in a channel with its participants
+func (r *Repository) GetActiveCall(ctx context.Context, channelID string) (*Session, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `SELECT ` + sessionColumns + ` FROM call_sessions WHERE channel_id = $1 AND status = $2`
+	session, err := scanSession(pool.QueryRow(ctx, query, channelID, StatusActive))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrCallNotFound
+		}
+		return nil, fmt.Errorf("failed to get active call: %w", err)
+	}
+
+	session.Participants, err = listParticipants(ctx, pool, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// querier runs queries returning rows; pools and transactions both qualify
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// listParticipants returns everyone who has joined a call, in join order
+func listParticipants(ctx context.Context, q querier, callID string) ([]Participant, error) {
+	query := `SELECT ` + participantColumns + ` FROM call_participants WHERE call_id = $1 ORDER BY joined_at`
+	rows, err := q.Query(ctx, query, callID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list call participants: %w", err)
+	}
+	defer rows.Close()
+
+	participants := []Participant{}
+	for rows.Next() {
+		participant, err := scanParticipant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan call participant: %w", err)
+		}
+		participants = append(participants, *participant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating call participants: %w", err)
+	}
+	return participants, nil
+}
+
+// JoinCall adds a user to an active call, or brings back one who left
+func (r *Repository) JoinCall(ctx context.Context, session *Session, userID string) (*Participant, error) {
+	pool := r.db.GetShardByChannelID(session.ChannelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockActiveCall(ctx, tx, session.ID); err != nil {
+		return nil, err
+	}
+
+	participant, err := upsertParticipant(ctx, tx, session.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit call join: %w", err)
+	}
+
+	return participant, nil
+}
+
+// LeaveCall records a user leaving a call. If nobody is left the call ends,
+// and the ended call is returned as well.
+func (r *Repository) LeaveCall(ctx context.Context, session *Session, userID string) (*Participant, *Session, error) {
+	pool := r.db.GetShardByChannelID(session.ChannelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the call orders this leave against joins, so a join cannot
+	// slip in between counting the remaining participants and ending it
+	if err := lockActiveCall(ctx, tx, session.ID); err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+		UPDATE call_participants
+		SET left_at = NOW(), signalling_state = $3
+		WHERE call_id = $1 AND user_id = $2 AND left_at IS NULL
+		RETURNING ` + participantColumns
+	participant, err := scanParticipant(tx.QueryRow(ctx, query, session.ID, userID, SignallingLeft))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil, ErrNotInCall
+		}
+		return nil, nil, fmt.Errorf("failed to leave call: %w", err)
+	}
+
+	var remaining int
+	countQuery := `SELECT COUNT(*) FROM call_participants WHERE call_id = $1 AND left_at IS NULL`
+	if err := tx.QueryRow(ctx, countQuery, session.ID).Scan(&remaining); err != nil {
+		return nil, nil, fmt.Errorf("failed to count call participants: %w", err)
+	}
+
+	var ended *Session
+	if remaining == 0 {
+		if ended, err = endCall(ctx, tx, session.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit call leave: %w", err)
+	}
+
+	return participant, ended, nil
+}
+
+// EndCall ends an active call for everyone still in it
+func (r *Repository) EndCall(ctx context.Context, session *Session) (*Session, error) {
+	pool := r.db.GetShardByChannelID(session.ChannelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockActiveCall(ctx, tx, session.ID); err != nil {
+		return nil, err
+	}
+
+	ended, err := endCall(ctx, tx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit call end: %w", err)
+	}
+
+	return ended, nil
+}
+
+// lockActiveCall locks a call's row for the rest of the transaction,
+// failing if the call has already ended
+func lockActiveCall(ctx context.Context, tx pgx.Tx, callID string) error {
+	var status string
+	err := tx.QueryRow(ctx, `SELECT status FROM call_sessions WHERE id = $1 FOR UPDATE`, callID).Scan(&status)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrCallNotFound
+		}
+		return fmt.Errorf("failed to lock call: %w", err)
+	}
+	if status != StatusActive {
+		return ErrCallEnded
+	}
+	return nil
+}
+
+// upsertParticipant records a user joining a call, resetting the record of
+// one who joined before
+func upsertParticipant(ctx context.Context, tx pgx.Tx, callID, userID string) (*Participant, error) {
+	query := `
+		INSERT INTO call_participants (call_id, user_id, joined_at, signalling_state)
+		VALUES ($1, $2, NOW(), $3)
+		ON CONFLICT (call_id, user_id) DO UPDATE SET
+			joined_at = CASE WHEN call_participants.left_at IS NULL THEN call_participants.joined_at ELSE NOW() END,
+			signalling_state = CASE WHEN call_participants.left_at IS NULL THEN call_participants.signalling_state ELSE EXCLUDED.signalling_state END,
+			left_at = NULL
+		RETURNING ` + participantColumns
+	participant, err := scanParticipant(tx.QueryRow(ctx, query, callID, userID, SignallingJoining))
+	if err != nil {
+		return nil, fmt.Errorf("failed to join call: %w", err)
+	}
+	return participant, nil
+}
+
+// endCall marks a locked call ended and everyone still in it as left, and
+// returns the ended call with its participants
+func endCall(ctx context.Context, tx pgx.Tx, callID string) (*Session, error) {
+	participantsQuery := `
+		UPDATE call_participants
+		SET left_at = NOW(), signalling_state = $2
+		WHERE call_id = $1 AND left_at IS NULL
+	`
+	if _, err := tx.Exec(ctx, participantsQuery, callID, SignallingLeft); err != nil {
+		return nil, fmt.Errorf("failed to remove call participants: %w", err)
+	}
+
+	query := `
+		UPDATE call_sessions SET status = $2, ended_at = NOW()
+		WHERE id = $1
+		RETURNING ` + sessionColumns
+	session, err := scanSession(tx.QueryRow(ctx, query, callID, StatusEnded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to end call: %w", err)
+	}
+
+	session.Participants, err = listParticipants(ctx, tx, callID)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
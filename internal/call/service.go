@@ -1,11 +1,19 @@
 package call
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"real-time-chat-system/internal/chat"
 	"real-time-chat-system/internal/config"
 	"real-time-chat-system/internal/database"
 	"real-time-chat-system/internal/health"
+	"real-time-chat-system/internal/identity"
+	"real-time-chat-system/internal/presence"
 	redisclient "real-time-chat-system/internal/redis"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,15 +24,21 @@ type Service struct {
 	healthChecker *health.Checker
 	db            *database.PostgresDB
 	redis         *redisclient.Client
+	signer        *identity.Signer
+	repository    *Repository
+	policy        *chat.Policy
 }
 
 // New create a new call service instance
-func New(cfg *config.CallConfig, healthChecker *health.Checker, db *database.PostgresDB, redisClient *redisclient.Client) (*Service, error) {
+func New(cfg *config.CallConfig, healthChecker *health.Checker, db *database.PostgresDB, redisClient *redisclient.Client, signer *identity.Signer) (*Service, error) {
 	service := &Service{
 		config:        cfg,
 		healthChecker: healthChecker,
 		db:            db,
 		redis:         redisClient,
+		signer:        signer,
+		repository:    NewRepository(db),
+		policy:        chat.NewPolicy(chat.NewRepository(db)),
 	}
 
 	// Add health checks
@@ -52,33 +66,265 @@ func (s *Service) Router() http.Handler {
 
 	// Service endpoints
 	v1 := router.Group("/v1")
+	v1.Use(s.signer.Middleware())
 	{
 		v1.POST("/calls", s.createCall)
+		v1.GET("/calls/:id", s.getCall)
 		v1.POST("/calls/:id/join", s.joinCall)
+		v1.POST("/calls/:id/leave", s.leaveCall)
+		v1.POST("/calls/:id/end", s.endCall)
 		v1.POST("/calls/:id/signaling", s.handleSignaling)
 	}
 
 	return router
 }
 
+// CreateCall starts a call in a channel the user may join calls in, with
+// the user as its first participant. An active call whose participants have
+// all disconnected is ended to make way for the new one.
+func (s *Service) CreateCall(ctx context.Context, userID string, req CreateCallRequest) (*Session, error) {
+	callType := req.CallType
+	if callType == "" {
+		callType = TypeAudio
+	}
+	if callType != TypeAudio && callType != TypeVideo {
+		return nil, ErrInvalidType
+	}
+
+	if _, err := s.policy.Authorize(ctx, req.ChannelID, userID, chat.ActionJoinCall); err != nil {
+		return nil, err
+	}
+
+	session, err := s.repository.CreateCall(ctx, req.ChannelID, userID, callType)
+	if errors.Is(err, ErrCallInProgress) && s.endAbandonedCall(ctx, req.ChannelID) {
+		session, err = s.repository.CreateCall(ctx, req.ChannelID, userID, callType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishEvent(ctx, session, EventCallStarted, session)
+	return session, nil
+}
+
+// endAbandonedCall ends the channel's active call if none of the
+// participants still in it is connected, as happens when every client drops
+// without leaving. It reports whether the channel is free for a new call.
+func (s *Service) endAbandonedCall(ctx context.Context, channelID string) bool {
+	session, err := s.repository.GetActiveCall(ctx, channelID)
+	if errors.Is(err, ErrCallNotFound) {
+		return true
+	}
+	if err != nil {
+		log.Printf("Failed to get active call in channel %s: %v", channelID, err)
+		return false
+	}
+
+	var userIDs []string
+	for _, participant := range session.Participants {
+		if participant.LeftAt == nil {
+			userIDs = append(userIDs, participant.UserID)
+		}
+	}
+	if len(userIDs) > 0 {
+		entries, err := s.redis.GetPresenceBatch(ctx, userIDs)
+		if err != nil {
+			log.Printf("Failed to check presence of call %s participants: %v", session.ID, err)
+			return false
+		}
+		now := time.Now()
+		for _, entry := range entries {
+			if presence.Connected(entry.Devices, now) {
+				return false
+			}
+		}
+	}
+
+	ended, err := s.repository.EndCall(ctx, session)
+	if errors.Is(err, ErrCallEnded) {
+		return true
+	}
+	if err != nil {
+		log.Printf("Failed to end abandoned call %s: %v", session.ID, err)
+		return false
+	}
+
+	s.publishEvent(ctx, ended, EventCallEnded, ended)
+	return true
+}
+
+// GetCall returns a call and its participants to a member of its channel
+func (s *Service) GetCall(ctx context.Context, callID, userID string) (*Session, error) {
+	session, err := s.repository.GetCall(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.policy.Authorize(ctx, session.ChannelID, userID, chat.ActionReadMessages); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// JoinCall adds the user to an active call and returns the call as it
+// stands after joining
+func (s *Service) JoinCall(ctx context.Context, callID, userID string) (*Session, error) {
+	session, err := s.repository.GetCall(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.policy.Authorize(ctx, session.ChannelID, userID, chat.ActionJoinCall); err != nil {
+		return nil, err
+	}
+
+	participant, err := s.repository.JoinCall(ctx, session, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.publishEvent(ctx, session, EventCallJoined, ParticipantEvent{
+		CallID:      session.ID,
+		ChannelID:   session.ChannelID,
+		Participant: *participant,
+	})
+
+	return s.repository.GetCall(ctx, callID)
+}
+
+// LeaveCall removes the user from a call. The last participant to leave
+// ends the call. No channel role is needed, so members removed from the
+// channel mid-call can still leave it.
+func (s *Service) LeaveCall(ctx context.Context, callID, userID string) error {
+	session, err := s.repository.GetCall(ctx, callID)
+	if err != nil {
+		return err
+	}
+
+	participant, ended, err := s.repository.LeaveCall(ctx, session, userID)
+	if err != nil {
+		return err
+	}
+
+	s.publishEvent(ctx, session, EventCallLeft, ParticipantEvent{
+		CallID:      session.ID,
+		ChannelID:   session.ChannelID,
+		Participant: *participant,
+	})
+	if ended != nil {
+		s.publishEvent(ctx, ended, EventCallEnded, ended)
+	}
+
+	return nil
+}
+
+// EndCall ends a call for everyone in it. The call's creator may end it
+// while they remain able to join calls in the channel; others need a role
+// allowed to end calls.
+func (s *Service) EndCall(ctx context.Context, callID, userID string) (*Session, error) {
+	session, err := s.repository.GetCall(ctx, callID)
+	if err != nil {
+		return nil, err
+	}
+
+	action := chat.ActionEndCall
+	if session.CreatedBy == userID {
+		action = chat.ActionJoinCall
+	}
+	if _, err := s.policy.Authorize(ctx, session.ChannelID, userID, action); err != nil {
+		return nil, err
+	}
+
+	ended, err := s.repository.EndCall(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishEvent(ctx, ended, EventCallEnded, ended)
+	return ended, nil
+}
+
+// publishEvent publishes a call event on the call's channel topic. Failures
+// are logged rather than returned: the call state is already stored and
+// clients can recover it with a lookup.
+func (s *Service) publishEvent(ctx context.Context, session *Session, eventType string, data interface{}) {
+	channelID := session.ChannelID
+	callID := session.ID
+	event := chat.WebSocketEvent{
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Data:      data,
+		ChannelID: &channelID,
+		CallID:    &callID,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", eventType, err)
+		return
+	}
+	if err := s.redis.Publish(ctx, chat.ChannelEventsTopic(channelID), payload); err != nil {
+		log.Printf("Failed to publish %s event for call %s: %v", eventType, callID, err)
+	}
+}
+
 // createCall handles call creation
 func (s *Service) createCall(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Call service - create call endpoints",
-		"service": "call-service",
-		"status":  "Database and Redis connected",
-	})
+	var req CreateCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := s.CreateCall(c.Request.Context(), identity.UserID(c), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// getCall handles call retrieval
+func (s *Service) getCall(c *gin.Context) {
+	session, err := s.GetCall(c.Request.Context(), c.Param("id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
 }
 
 // joinCall handles joining a call
 func (s *Service) joinCall(c *gin.Context) {
-	callID := c.Param("id")
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Call service - join call endpoint",
-		"service": "call-service",
-		"callID":  callID,
-		"status":  "Database and Redis connected",
-	})
+	session, err := s.JoinCall(c.Request.Context(), c.Param("id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// leaveCall handles leaving a call
+func (s *Service) leaveCall(c *gin.Context) {
+	if err := s.LeaveCall(c.Request.Context(), c.Param("id"), identity.UserID(c)); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// endCall handles ending a call for everyone
+func (s *Service) endCall(c *gin.Context) {
+	session, err := s.EndCall(c.Request.Context(), c.Param("id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
 }
 
 // handleSignaling handles WebRTC signaling messages
@@ -0,0 +1,538 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// attachmentColumns lists the message_attachments columns read by
+// scanAttachment, in order
+const attachmentColumns = `id, channel_id, message_id, uploaded_by, filename, content_type, size, storage_key, width, height, blurhash, created_at`
+
+// scanAttachment scans a row selected with attachmentColumns
+func scanAttachment(row pgx.Row) (*Attachment, error) {
+	var attachment Attachment
+	err := row.Scan(
+		&attachment.ID,
+		&attachment.ChannelID,
+		&attachment.MessageID,
+		&attachment.UploadedBy,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.StorageKey,
+		&attachment.Width,
+		&attachment.Height,
+		&attachment.Blurhash,
+		&attachment.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// querier runs queries returning rows; pools and transactions both qualify
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// uploadColumns lists the attachment_uploads columns read by scanUpload, in order
+const uploadColumns = `id, channel_id, user_id, filename, content_type, size, received, parts, created_at, expires_at`
+
+// scanUpload scans a row selected with uploadColumns
+func scanUpload(row pgx.Row) (*AttachmentUpload, error) {
+	var upload AttachmentUpload
+	err := row.Scan(
+		&upload.ID,
+		&upload.ChannelID,
+		&upload.UserID,
+		&upload.Filename,
+		&upload.ContentType,
+		&upload.Size,
+		&upload.Offset,
+		&upload.Parts,
+		&upload.CreatedAt,
+		&upload.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// CreateUpload starts a resumable upload
+func (r *Repository) CreateUpload(ctx context.Context, upload *AttachmentUpload) error {
+	pool := r.db.GetShardByChannelID(upload.ChannelID)
+
+	query := `
+		INSERT INTO attachment_uploads (id, channel_id, user_id, filename, size, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), $6)
+		RETURNING created_at
+	`
+	err := pool.QueryRow(ctx, query,
+		upload.ID, upload.ChannelID, upload.UserID, upload.Filename, upload.Size, upload.ExpiresAt,
+	).Scan(&upload.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", mapForeignKeyError(err))
+	}
+
+	return nil
+}
+
+// GetUpload returns one of the user's unexpired uploads
+func (r *Repository) GetUpload(ctx context.Context, channelID, uploadID, userID string) (*AttachmentUpload, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT ` + uploadColumns + `
+		FROM attachment_uploads
+		WHERE id = $1 AND channel_id = $2 AND user_id = $3 AND expires_at > NOW()
+	`
+
+	upload, err := scanUpload(pool.QueryRow(ctx, query, uploadID, channelID, userID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+// AppendChunk locks an upload, checks that offset is where the upload left
+// off and calls write to store the chunk. write returns the number of bytes
+// stored and the content type sniffed from the first chunk. The lock keeps
+// concurrent chunks for the same offset from both being stored.
+func (r *Repository) AppendChunk(ctx context.Context, channelID, uploadID, userID string, offset int64,
+	write func(upload *AttachmentUpload) (int64, string, error)) (*AttachmentUpload, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	lockQuery := `
+		SELECT ` + uploadColumns + `
+		FROM attachment_uploads
+		WHERE id = $1 AND channel_id = $2 AND user_id = $3 AND expires_at > NOW()
+		FOR UPDATE
+	`
+	upload, err := scanUpload(tx.QueryRow(ctx, lockQuery, uploadID, channelID, userID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to lock upload: %w", err)
+	}
+	if upload.Offset != offset {
+		return nil, &OffsetError{Offset: upload.Offset}
+	}
+
+	written, contentType, err := write(upload)
+	if err != nil {
+		return nil, err
+	}
+	if written == 0 {
+		return upload, nil
+	}
+
+	updateQuery := `
+		UPDATE attachment_uploads
+		SET received = received + $2,
+			parts = parts + 1,
+			content_type = CASE WHEN content_type = '' THEN $3 ELSE content_type END
+		WHERE id = $1
+		RETURNING ` + uploadColumns + `
+	`
+	upload, err = scanUpload(tx.QueryRow(ctx, updateQuery, uploadID, written, contentType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record chunk: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit chunk: %w", err)
+	}
+
+	return upload, nil
+}
+
+// CompleteUpload records a fully received upload as a pending attachment
+// of size bytes stored under storageKey and removes the upload. The
+// attachment takes the upload's ID, so completing twice returns the same
+// attachment.
+func (r *Repository) CompleteUpload(ctx context.Context, upload *AttachmentUpload, storageKey string, size int64) (*Attachment, error) {
+	pool := r.db.GetShardByChannelID(upload.ChannelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	insertQuery := `
+		INSERT INTO message_attachments (id, channel_id, uploaded_by, filename, content_type, size, storage_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (id) DO NOTHING
+	`
+	_, err = tx.Exec(ctx, insertQuery,
+		upload.ID, upload.ChannelID, upload.UserID, upload.Filename, upload.ContentType, size, storageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attachment: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM attachment_uploads WHERE id = $1`, upload.ID); err != nil {
+		return nil, fmt.Errorf("failed to remove upload: %w", err)
+	}
+
+	query := `SELECT ` + attachmentColumns + ` FROM message_attachments WHERE id = $1`
+	attachment, err := scanAttachment(tx.QueryRow(ctx, query, upload.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit attachment: %w", err)
+	}
+
+	return attachment, nil
+}
+
+// GetAttachment returns an attachment in a channel. Attachments of deleted
+// messages are not found.
+func (r *Repository) GetAttachment(ctx context.Context, channelID, attachmentID string) (*Attachment, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM message_attachments a
+		WHERE id = $1 AND channel_id = $2
+			AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.id = a.message_id AND m.deleted_at IS NOT NULL)
+	`
+
+	attachment, err := scanAttachment(pool.QueryRow(ctx, query, attachmentID, channelID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+
+	if err := attachThumbnails(ctx, pool, []*Attachment{attachment}); err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// attachmentMessageType picks the message type for a message carrying the
+// user's pending attachments: image when all of them are images, else file
+func attachmentMessageType(ctx context.Context, q rowQuerier, req SendMessageRequest) (string, error) {
+	query := `
+		SELECT COALESCE(BOOL_AND(content_type LIKE 'image/%'), FALSE)
+		FROM message_attachments
+		WHERE id = ANY($1::uuid[]) AND channel_id = $2 AND uploaded_by = $3 AND message_id IS NULL
+	`
+
+	var allImages bool
+	if err := q.QueryRow(ctx, query, req.AttachmentIDs, req.ChannelID, req.UserID).Scan(&allImages); err != nil {
+		return "", fmt.Errorf("failed to check attachment types: %w", err)
+	}
+	if allImages {
+		return "image", nil
+	}
+	return "file", nil
+}
+
+// linkAttachments claims the user's pending attachments for a message. It
+// fails if any of them is missing or already claimed.
+func linkAttachments(ctx context.Context, tx pgx.Tx, message *Message, attachmentIDs []string) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE message_attachments SET message_id = $1
+		WHERE id = ANY($2::uuid[]) AND channel_id = $3 AND uploaded_by = $4 AND message_id IS NULL
+		RETURNING ` + attachmentColumns + `
+	`
+
+	rows, err := tx.Query(ctx, query, message.ID, attachmentIDs, message.ChannelID, message.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to link attachments: %w", err)
+	}
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		message.Attachments = append(message.Attachments, *attachment)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating attachments: %w", err)
+	}
+	if len(message.Attachments) != len(attachmentIDs) {
+		return ErrAttachmentNotFound
+	}
+
+	return attachThumbnails(ctx, tx, attachmentPointers(message.Attachments))
+}
+
+// attachAttachments fills in the attachments of a page of messages, in
+// upload order. Deleted messages keep no attachments.
+func (r *Repository) attachAttachments(ctx context.Context, channelID string, messages []Message) error {
+	index := make(map[string]int, len(messages))
+	messageIDs := make([]string, 0, len(messages))
+	for i, message := range messages {
+		if message.Deleted {
+			continue
+		}
+		index[message.ID] = i
+		messageIDs = append(messageIDs, message.ID)
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM message_attachments
+		WHERE message_id = ANY($1::uuid[])
+		ORDER BY created_at, id
+	`
+
+	rows, err := pool.Query(ctx, query, messageIDs)
+	if err != nil {
+		return fmt.Errorf("failed to query attachments: %w", err)
+	}
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		if i, ok := index[*attachment.MessageID]; ok {
+			messages[i].Attachments = append(messages[i].Attachments, *attachment)
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating attachments: %w", err)
+	}
+
+	var attachments []*Attachment
+	for i := range messages {
+		attachments = append(attachments, attachmentPointers(messages[i].Attachments)...)
+	}
+	return attachThumbnails(ctx, pool, attachments)
+}
+
+// attachThumbnails fills in the thumbnails of attachments, smallest first
+func attachThumbnails(ctx context.Context, q querier, attachments []*Attachment) error {
+	index := make(map[string]*Attachment, len(attachments))
+	attachmentIDs := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		// Only attachments with a preview have thumbnails
+		if attachment.Blurhash != nil {
+			index[attachment.ID] = attachment
+			attachmentIDs = append(attachmentIDs, attachment.ID)
+		}
+	}
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT attachment_id, max_edge, width, height, content_type, size, storage_key
+		FROM attachment_thumbnails
+		WHERE attachment_id = ANY($1::uuid[])
+		ORDER BY max_edge
+	`
+
+	rows, err := q.Query(ctx, query, attachmentIDs)
+	if err != nil {
+		return fmt.Errorf("failed to query thumbnails: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attachmentID string
+		var thumbnail AttachmentThumbnail
+		err := rows.Scan(
+			&attachmentID,
+			&thumbnail.MaxEdge,
+			&thumbnail.Width,
+			&thumbnail.Height,
+			&thumbnail.ContentType,
+			&thumbnail.Size,
+			&thumbnail.StorageKey,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan thumbnail: %w", err)
+		}
+		if attachment, ok := index[attachmentID]; ok {
+			attachment.Thumbnails = append(attachment.Thumbnails, thumbnail)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating thumbnails: %w", err)
+	}
+
+	return nil
+}
+
+// attachmentPointers returns pointers to each of attachments, so they can be
+// filled in place
+func attachmentPointers(attachments []Attachment) []*Attachment {
+	pointers := make([]*Attachment, len(attachments))
+	for i := range attachments {
+		pointers[i] = &attachments[i]
+	}
+	return pointers
+}
+
+// SavePreview records an image attachment's generated preview: its
+// dimensions, blurhash and thumbnails. It reports false, saving nothing,
+// when the attachment is gone or already has a preview. The attachment's
+// MessageID is refreshed, since it may have been sent while the preview was
+// generated.
+func (r *Repository) SavePreview(ctx context.Context, attachment *Attachment) (bool, error) {
+	pool := r.db.GetShardByChannelID(attachment.ChannelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	thumbnailQuery := `
+		INSERT INTO attachment_thumbnails (attachment_id, max_edge, width, height, content_type, size, storage_key)
+		SELECT id, $2, $3, $4, $5, $6, $7 FROM message_attachments WHERE id = $1
+		ON CONFLICT (attachment_id, max_edge) DO NOTHING
+	`
+	for _, thumbnail := range attachment.Thumbnails {
+		_, err := tx.Exec(ctx, thumbnailQuery, attachment.ID, thumbnail.MaxEdge, thumbnail.Width, thumbnail.Height,
+			thumbnail.ContentType, thumbnail.Size, thumbnail.StorageKey)
+		if err != nil {
+			return false, fmt.Errorf("failed to save thumbnail: %w", err)
+		}
+	}
+
+	updateQuery := `
+		UPDATE message_attachments
+		SET width = $2, height = $3, blurhash = $4
+		WHERE id = $1 AND blurhash IS NULL
+		RETURNING message_id
+	`
+	err = tx.QueryRow(ctx, updateQuery, attachment.ID,
+		attachment.Width, attachment.Height, attachment.Blurhash).Scan(&attachment.MessageID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to save preview: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit preview: %w", err)
+	}
+
+	return true, nil
+}
+
+// DeleteExpiredUploads removes unfinished uploads past their expiry on every
+// shard and returns them so their stored chunks can be deleted
+func (r *Repository) DeleteExpiredUploads(ctx context.Context, now time.Time) ([]AttachmentUpload, error) {
+	query := `DELETE FROM attachment_uploads WHERE expires_at < $1 RETURNING ` + uploadColumns
+
+	seen := make(map[string]bool)
+	uploads := []AttachmentUpload{}
+	for i, pool := range r.db.Shards() {
+		rows, err := pool.Query(ctx, query, now)
+		if err != nil {
+			return uploads, fmt.Errorf("failed to delete expired uploads on shard %d: %w", i, err)
+		}
+
+		for rows.Next() {
+			upload, err := scanUpload(rows)
+			if err != nil {
+				rows.Close()
+				return uploads, fmt.Errorf("failed to scan upload: %w", err)
+			}
+			if !seen[upload.ID] {
+				seen[upload.ID] = true
+				uploads = append(uploads, *upload)
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return uploads, fmt.Errorf("error iterating expired uploads on shard %d: %w", i, err)
+		}
+	}
+
+	return uploads, nil
+}
+
+// DeleteStaleAttachments removes, on every shard, attachments of messages
+// deleted before deletedBefore and attachments never sent with a message
+// that were uploaded before unclaimedBefore. It returns the storage keys of
+// their files and thumbnails.
+func (r *Repository) DeleteStaleAttachments(ctx context.Context, deletedBefore, unclaimedBefore time.Time) ([]string, error) {
+	// Thumbnails go by cascade, but the statement still sees them, so
+	// their keys are returned too
+	query := `
+		WITH deleted AS (
+			DELETE FROM message_attachments a
+			WHERE (a.message_id IS NULL AND a.created_at < $2)
+				OR EXISTS (SELECT 1 FROM messages m WHERE m.id = a.message_id AND m.deleted_at < $1)
+			RETURNING a.id, a.storage_key
+		)
+		SELECT storage_key FROM deleted
+		UNION ALL
+		SELECT t.storage_key FROM attachment_thumbnails t JOIN deleted d ON d.id = t.attachment_id
+	`
+
+	seen := make(map[string]bool)
+	keys := []string{}
+	for i, pool := range r.db.Shards() {
+		rows, err := pool.Query(ctx, query, deletedBefore, unclaimedBefore)
+		if err != nil {
+			return keys, fmt.Errorf("failed to delete stale attachments on shard %d: %w", i, err)
+		}
+
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return keys, fmt.Errorf("failed to scan attachment key: %w", err)
+			}
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return keys, fmt.Errorf("error iterating stale attachments on shard %d: %w", i, err)
+		}
+	}
+
+	return keys, nil
+}
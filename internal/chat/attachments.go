@@ -0,0 +1,518 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"real-time-chat-system/internal/identity"
+	"real-time-chat-system/internal/media"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Attachment limits that are not configurable
+const (
+	maxFilenameLength     = 255
+	maxAttachmentsPerSend = 10
+)
+
+// Query parameters of a signed download URL
+const (
+	downloadParamChannel   = "channel_id"
+	downloadParamUser      = "user_id"
+	downloadParamExpires   = "expires"
+	downloadParamSignature = "signature"
+	downloadParamThumbnail = "thumbnail"
+)
+
+// CreateUpload starts a resumable upload of a file to a channel
+func (s *Service) CreateUpload(ctx context.Context, channelID, userID string, req CreateUploadRequest) (*AttachmentUpload, error) {
+	filename := path.Base(strings.ReplaceAll(strings.TrimSpace(req.Filename), "\\", "/"))
+	if filename == "." || filename == "/" || len(filename) > maxFilenameLength {
+		return nil, ErrInvalidUpload
+	}
+	if req.Size <= 0 || req.Size > s.config.Attachments.GetMaxSize() {
+		return nil, ErrInvalidUpload
+	}
+
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionPostMessage); err != nil {
+		return nil, err
+	}
+
+	upload := &AttachmentUpload{
+		ID:        uuid.NewString(),
+		ChannelID: channelID,
+		UserID:    userID,
+		Filename:  filename,
+		Size:      req.Size,
+		ExpiresAt: time.Now().Add(s.config.Attachments.GetUploadTTL()),
+	}
+	if err := s.repository.CreateUpload(ctx, upload); err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// GetUpload returns an unfinished upload so the client can resume it
+func (s *Service) GetUpload(ctx context.Context, channelID, uploadID, userID string) (*AttachmentUpload, error) {
+	return s.repository.GetUpload(ctx, channelID, uploadID, userID)
+}
+
+// UploadChunk stores the next chunk of an upload, which must start at the
+// number of bytes received so far. The first chunk's content decides the
+// file type. Once every byte has arrived the chunks are assembled into the
+// attachment; if that fails, sending an empty chunk at the final offset
+// retries it.
+func (s *Service) UploadChunk(ctx context.Context, channelID, uploadID, userID string, offset int64, body io.Reader) (*AttachmentUpload, error) {
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionPostMessage); err != nil {
+		return nil, err
+	}
+
+	upload, err := s.repository.AppendChunk(ctx, channelID, uploadID, userID, offset,
+		func(upload *AttachmentUpload) (int64, string, error) {
+			return s.storeChunk(ctx, upload, body)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Offset < upload.Size {
+		return upload, nil
+	}
+
+	attachment, err := s.completeUpload(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+	s.signAttachmentURL(attachment, userID)
+	upload.Attachment = attachment
+	return upload, nil
+}
+
+// storeChunk reads one chunk and stores it as the upload's next part,
+// returning its length and, for the first chunk, the sniffed content type
+func (s *Service) storeChunk(ctx context.Context, upload *AttachmentUpload, body io.Reader) (int64, string, error) {
+	limit := s.config.Attachments.GetMaxChunkSize()
+	if remaining := upload.Size - upload.Offset; remaining < limit {
+		limit = remaining
+	}
+
+	chunk, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if int64(len(chunk)) > limit {
+		return 0, "", ErrChunkTooLarge
+	}
+	if len(chunk) == 0 {
+		return 0, "", nil
+	}
+
+	contentType := upload.ContentType
+	if upload.Offset == 0 {
+		contentType = http.DetectContentType(chunk)
+		if !s.attachmentTypeAllowed(contentType) {
+			return 0, "", ErrUnsupportedFileType
+		}
+	}
+
+	key := uploadPartKey(upload, upload.Parts)
+	if err := s.blobs.Put(ctx, key, bytes.NewReader(chunk), int64(len(chunk)), "application/octet-stream"); err != nil {
+		return 0, "", err
+	}
+
+	return int64(len(chunk)), contentType, nil
+}
+
+// completeUpload assembles an upload's parts into its attachment blob,
+// records the attachment and deletes the parts
+func (s *Service) completeUpload(ctx context.Context, upload *AttachmentUpload) (*Attachment, error) {
+	key := attachmentKey(upload.ChannelID, upload.ID)
+	size, err := s.assembleUpload(ctx, upload, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assemble upload: %w", err)
+	}
+
+	attachment, err := s.repository.CompleteUpload(ctx, upload, key, size)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteUploadParts(ctx, upload)
+	s.enqueuePreview(ctx, attachment)
+	return attachment, nil
+}
+
+// assembleUpload writes an upload's parts to key and returns the stored
+// size. Images are stripped of their metadata on the way, so the original
+// with its locations is never downloadable; other files are streamed as
+// they are.
+func (s *Service) assembleUpload(ctx context.Context, upload *AttachmentUpload, key string) (int64, error) {
+	parts := &partReader{ctx: ctx, service: s, upload: upload}
+	defer parts.Close()
+
+	if !media.Supported(upload.ContentType) {
+		if err := s.blobs.Put(ctx, key, parts, upload.Size, upload.ContentType); err != nil {
+			return 0, err
+		}
+		return upload.Size, nil
+	}
+
+	original, err := io.ReadAll(parts)
+	if err != nil {
+		return 0, err
+	}
+	stripped := media.StripMetadata(original)
+	if err := s.blobs.Put(ctx, key, bytes.NewReader(stripped), int64(len(stripped)), upload.ContentType); err != nil {
+		return 0, err
+	}
+	return int64(len(stripped)), nil
+}
+
+// GetAttachment returns an attachment with a signed download URL. Pending
+// attachments are only visible to their uploader.
+func (s *Service) GetAttachment(ctx context.Context, channelID, attachmentID, userID string) (*Attachment, error) {
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionReadMessages); err != nil {
+		return nil, err
+	}
+
+	attachment, err := s.repository.GetAttachment(ctx, channelID, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.MessageID == nil && attachment.UploadedBy != userID {
+		return nil, ErrAttachmentNotFound
+	}
+
+	s.signAttachmentURL(attachment, userID)
+	return attachment, nil
+}
+
+// OpenAttachment checks a signed download URL and opens the attachment it
+// points to. Membership is checked again, so links stop working for users
+// who leave the channel. When the URL names a thumbnail, the thumbnail is
+// opened instead and the returned attachment carries its content type and
+// size.
+func (s *Service) OpenAttachment(ctx context.Context, attachmentID string, query url.Values) (*Attachment, io.ReadCloser, error) {
+	channelID := query.Get(downloadParamChannel)
+	userID := query.Get(downloadParamUser)
+	expires, err := strconv.ParseInt(query.Get(downloadParamExpires), 10, 64)
+	if err != nil || channelID == "" || userID == "" {
+		return nil, nil, ErrInvalidDownloadURL
+	}
+
+	expected := s.downloadSignature(attachmentID, channelID, userID, expires)
+	if !hmac.Equal([]byte(query.Get(downloadParamSignature)), []byte(expected)) {
+		return nil, nil, ErrInvalidDownloadURL
+	}
+	if time.Now().Unix() > expires {
+		return nil, nil, ErrInvalidDownloadURL
+	}
+
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionReadMessages); err != nil {
+		return nil, nil, err
+	}
+
+	attachment, err := s.repository.GetAttachment(ctx, channelID, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if attachment.MessageID == nil && attachment.UploadedBy != userID {
+		return nil, nil, ErrAttachmentNotFound
+	}
+
+	if edge := query.Get(downloadParamThumbnail); edge != "" {
+		thumbnail := findThumbnail(attachment, edge)
+		if thumbnail == nil {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		attachment.ContentType = thumbnail.ContentType
+		attachment.Size = thumbnail.Size
+		attachment.StorageKey = thumbnail.StorageKey
+	}
+
+	content, err := s.blobs.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open attachment: %w", err)
+	}
+
+	return attachment, content, nil
+}
+
+// signAttachmentURLs gives every attachment on a page of messages a signed
+// download URL for the reader
+func (s *Service) signAttachmentURLs(messages []Message, userID string) {
+	for i := range messages {
+		s.signMessageAttachments(&messages[i], userID)
+	}
+}
+
+// signMessageAttachments gives a message's attachments signed download URLs
+// for the reader
+func (s *Service) signMessageAttachments(message *Message, userID string) {
+	for i := range message.Attachments {
+		s.signAttachmentURL(&message.Attachments[i], userID)
+	}
+}
+
+// signAttachmentURL sets a short-lived download URL bound to the user
+func (s *Service) signAttachmentURL(attachment *Attachment, userID string) {
+	expiresAt := time.Now().Add(s.config.Attachments.GetURLTTL()).Truncate(time.Second)
+	expires := expiresAt.Unix()
+
+	query := url.Values{}
+	query.Set(downloadParamChannel, attachment.ChannelID)
+	query.Set(downloadParamUser, userID)
+	query.Set(downloadParamExpires, strconv.FormatInt(expires, 10))
+	query.Set(downloadParamSignature, s.downloadSignature(attachment.ID, attachment.ChannelID, userID, expires))
+
+	attachment.URL = "/v1/attachments/" + attachment.ID + "/content?" + query.Encode()
+	attachment.URLExpiresAt = &expiresAt
+
+	// Thumbnails share the attachment's signature; the size only picks
+	// which copy is served
+	for i := range attachment.Thumbnails {
+		thumbnail := &attachment.Thumbnails[i]
+		thumbnail.URL = attachment.URL + "&" + downloadParamThumbnail + "=" + strconv.Itoa(thumbnail.MaxEdge)
+	}
+}
+
+// findThumbnail returns the attachment's thumbnail with the given maximum
+// edge, or nil if it has none
+func findThumbnail(attachment *Attachment, maxEdge string) *AttachmentThumbnail {
+	for i := range attachment.Thumbnails {
+		if strconv.Itoa(attachment.Thumbnails[i].MaxEdge) == maxEdge {
+			return &attachment.Thumbnails[i]
+		}
+	}
+	return nil
+}
+
+// downloadSignature computes the HMAC binding a download URL to an
+// attachment, channel, user and expiry time
+func (s *Service) downloadSignature(attachmentID, channelID, userID string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Attachments.URLSecret))
+	mac.Write([]byte(attachmentID + "\n" + channelID + "\n" + userID + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// attachmentTypeAllowed checks a sniffed content type against the allowed
+// media types, ignoring parameters such as charset
+func (s *Service) attachmentTypeAllowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range s.config.Attachments.AllowedTypes {
+		if strings.EqualFold(mediaType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeAttachments deletes expired uploads and stale attachments along with
+// their stored files. Attachments of messages deleted before the cutoff go
+// with the message content; pending attachments go once the upload TTL has
+// passed without a message claiming them.
+func (s *Service) purgeAttachments(ctx context.Context, cutoff time.Time) {
+	now := time.Now()
+
+	uploads, err := s.repository.DeleteExpiredUploads(ctx, now)
+	for i := range uploads {
+		s.deleteUploadParts(ctx, &uploads[i])
+	}
+	if err != nil {
+		log.Printf("Failed to delete expired uploads: %v", err)
+	}
+
+	keys, err := s.repository.DeleteStaleAttachments(ctx, cutoff, now.Add(-s.config.Attachments.GetUploadTTL()))
+	for _, key := range keys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete attachment blob %s: %v", key, err)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to delete stale attachments: %v", err)
+	}
+}
+
+// deleteUploadParts deletes an upload's stored chunks. Failures only leave
+// unreferenced files behind, so they are logged.
+func (s *Service) deleteUploadParts(ctx context.Context, upload *AttachmentUpload) {
+	for part := 0; part < upload.Parts; part++ {
+		if err := s.blobs.Delete(ctx, uploadPartKey(upload, part)); err != nil {
+			log.Printf("Failed to delete upload part %s: %v", uploadPartKey(upload, part), err)
+		}
+	}
+}
+
+// uniqueStrings returns values without duplicates, keeping the first of each
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// uploadPartKey is the blob key of one chunk of an upload
+func uploadPartKey(upload *AttachmentUpload, part int) string {
+	return fmt.Sprintf("uploads/%s/%s/%06d", upload.ChannelID, upload.ID, part)
+}
+
+// attachmentKey is the blob key of a completed attachment
+func attachmentKey(channelID, attachmentID string) string {
+	return "attachments/" + channelID + "/" + attachmentID
+}
+
+// partReader reads an upload's parts in order, opening each one only when
+// the previous one is exhausted
+type partReader struct {
+	ctx     context.Context
+	service *Service
+	upload  *AttachmentUpload
+	next    int
+	current io.ReadCloser
+}
+
+func (r *partReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.next >= r.upload.Parts {
+				return 0, io.EOF
+			}
+			part, err := r.service.blobs.Get(r.ctx, uploadPartKey(r.upload, r.next))
+			if err != nil {
+				return 0, fmt.Errorf("failed to open upload part %d: %w", r.next, err)
+			}
+			r.current = part
+			r.next++
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close closes the part being read, if any
+func (r *partReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
+
+// createUploadHandler handles starting an upload
+func (s *Service) createUploadHandler(c *gin.Context) {
+	var req CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	upload, err := s.CreateUpload(c.Request.Context(), c.Param("channel_id"), identity.UserID(c), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, upload)
+}
+
+// getUploadHandler handles upload status lookups, used to resume uploads
+func (s *Service) getUploadHandler(c *gin.Context) {
+	upload, err := s.GetUpload(c.Request.Context(), c.Param("channel_id"), c.Param("upload_id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, upload)
+}
+
+// uploadChunkHandler handles a chunk of an upload. The chunk's starting
+// offset is given in the Upload-Offset header.
+func (s *Service) uploadChunkHandler(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header must be a non-negative byte offset"})
+		return
+	}
+
+	upload, err := s.UploadChunk(c.Request.Context(), c.Param("channel_id"), c.Param("upload_id"), identity.UserID(c), offset, c.Request.Body)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if upload.Attachment != nil {
+		c.JSON(http.StatusCreated, upload)
+		return
+	}
+	c.JSON(http.StatusOK, upload)
+}
+
+// getAttachmentHandler handles attachment lookups, returning a fresh
+// download URL
+func (s *Service) getAttachmentHandler(c *gin.Context) {
+	attachment, err := s.GetAttachment(c.Request.Context(), c.Param("channel_id"), c.Param("attachment_id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+// downloadAttachmentHandler streams an attachment to the holder of a signed URL
+func (s *Service) downloadAttachmentHandler(c *gin.Context) {
+	attachment, content, err := s.OpenAttachment(c.Request.Context(), c.Param("attachment_id"), c.Request.URL.Query())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer content.Close()
+
+	// Only media is shown inline; anything else is downloaded, and the
+	// browser must not second-guess the sniffed type
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") || strings.HasPrefix(attachment.ContentType, "video/") ||
+		strings.HasPrefix(attachment.ContentType, "audio/") {
+		disposition = "inline"
+	}
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, content, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=" + strconv.Itoa(int(s.config.Attachments.GetURLTTL().Seconds())),
+	})
+}
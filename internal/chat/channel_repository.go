@@ -0,0 +1,482 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgreSQL error codes
+const (
+	foreignKeyViolation = "23503"
+)
+
+// CreateChannel inserts a channel and its initial members on the channel's
+// shard. members maps user IDs to their roles.
+func (r *Repository) CreateChannel(ctx context.Context, channel *Channel, members map[string]string) error {
+	for userID := range members {
+		if err := r.indexMembership(ctx, userID, channel.ID); err != nil {
+			return err
+		}
+	}
+
+	pool := r.db.GetShardByChannelID(channel.ID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO channels (id, name, type, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING created_at, updated_at
+	`
+	err = tx.QueryRow(ctx, query, channel.ID, channel.Name, channel.Type, channel.CreatedBy).Scan(
+		&channel.CreatedAt,
+		&channel.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create channel: %w", mapForeignKeyError(err))
+	}
+
+	memberQuery := `
+		INSERT INTO channel_members (channel_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, NOW())
+	`
+	for userID, role := range members {
+		if _, err := tx.Exec(ctx, memberQuery, channel.ID, userID, role); err != nil {
+			return fmt.Errorf("failed to add channel member: %w", mapForeignKeyError(err))
+		}
+		channel.Members = append(channel.Members, userID)
+	}
+	sort.Strings(channel.Members)
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit channel: %w", err)
+	}
+
+	return nil
+}
+
+// RenameChannel updates a channel's name
+func (r *Repository) RenameChannel(ctx context.Context, channelID, name string) (*Channel, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		UPDATE channels SET name = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, name, type, created_by, created_at, updated_at
+	`
+
+	var channel Channel
+	err := pool.QueryRow(ctx, query, channelID, name).Scan(
+		&channel.ID,
+		&channel.Name,
+		&channel.Type,
+		&channel.CreatedBy,
+		&channel.CreatedAt,
+		&channel.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrChannelNotFound
+		}
+		return nil, fmt.Errorf("failed to rename channel: %w", err)
+	}
+
+	return &channel, nil
+}
+
+// DeleteChannel deletes a channel; messages are removed by cascade
+func (r *Repository) DeleteChannel(ctx context.Context, channelID string) error {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Remove the members explicitly to learn whose channel index to update
+	rows, err := tx.Query(ctx, `DELETE FROM channel_members WHERE channel_id = $1 RETURNING user_id`, channelID)
+	if err != nil {
+		return fmt.Errorf("failed to delete channel members: %w", err)
+	}
+	var memberIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan channel member: %w", err)
+		}
+		memberIDs = append(memberIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating channel members: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM channels WHERE id = $1`, channelID)
+	if err != nil {
+		return fmt.Errorf("failed to delete channel: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrChannelNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit channel deletion: %w", err)
+	}
+
+	for _, userID := range memberIDs {
+		r.unindexMembership(ctx, userID, channelID)
+	}
+
+	return nil
+}
+
+// GetMemberRole returns a user's role in a channel
+func (r *Repository) GetMemberRole(ctx context.Context, channelID, userID string) (string, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT COALESCE(role, 'member')
+		FROM channel_members
+		WHERE channel_id = $1 AND user_id = $2
+	`
+
+	var role string
+	err := pool.QueryRow(ctx, query, channelID, userID).Scan(&role)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrNotChannelMember
+		}
+		return "", fmt.Errorf("failed to get member role: %w", err)
+	}
+
+	return role, nil
+}
+
+// GetChannelForMember returns a channel with the user's role in it. Role is
+// empty when the user is not a member.
+func (r *Repository) GetChannelForMember(ctx context.Context, channelID, userID string) (*Channel, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT c.id, c.name, c.type, c.created_by, c.created_at, c.updated_at, COALESCE(m.role, '')
+		FROM channels c
+		LEFT JOIN channel_members m ON m.channel_id = c.id AND m.user_id = $2
+		WHERE c.id = $1
+	`
+
+	var channel Channel
+	err := pool.QueryRow(ctx, query, channelID, userID).Scan(
+		&channel.ID,
+		&channel.Name,
+		&channel.Type,
+		&channel.CreatedBy,
+		&channel.CreatedAt,
+		&channel.UpdatedAt,
+		&channel.Role,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrChannelNotFound
+		}
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	return &channel, nil
+}
+
+// UpdateMemberRole changes a member's role
+func (r *Repository) UpdateMemberRole(ctx context.Context, channelID, userID, role string) (*ChannelMember, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		UPDATE channel_members SET role = $3
+		WHERE channel_id = $1 AND user_id = $2
+		RETURNING channel_id, user_id, joined_at, role
+	`
+
+	var member ChannelMember
+	err := pool.QueryRow(ctx, query, channelID, userID, role).Scan(
+		&member.ChannelID,
+		&member.UserID,
+		&member.JoinedAt,
+		&member.Role,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrNotChannelMember
+		}
+		return nil, fmt.Errorf("failed to update member role: %w", err)
+	}
+
+	return &member, nil
+}
+
+// AddMember adds a user to a channel with the given role
+func (r *Repository) AddMember(ctx context.Context, channelID, userID, role string) (*ChannelMember, error) {
+	if err := r.indexMembership(ctx, userID, channelID); err != nil {
+		return nil, err
+	}
+
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		INSERT INTO channel_members (channel_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (channel_id, user_id) DO NOTHING
+		RETURNING channel_id, user_id, joined_at, role
+	`
+
+	var member ChannelMember
+	err := pool.QueryRow(ctx, query, channelID, userID, role).Scan(
+		&member.ChannelID,
+		&member.UserID,
+		&member.JoinedAt,
+		&member.Role,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrAlreadyMember
+		}
+		return nil, fmt.Errorf("failed to add channel member: %w", mapForeignKeyError(err))
+	}
+
+	return &member, nil
+}
+
+// RemoveMember removes a user from a channel
+func (r *Repository) RemoveMember(ctx context.Context, channelID, userID string) error {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `DELETE FROM channel_members WHERE channel_id = $1 AND user_id = $2`
+	tag, err := pool.Exec(ctx, query, channelID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove channel member: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotChannelMember
+	}
+
+	r.unindexMembership(ctx, userID, channelID)
+	return nil
+}
+
+// LeaveChannel removes a member leaving a channel of their own accord,
+// refusing the owner while other members remain. The channel row is locked
+// for the check, which also holds off members being added meanwhile, since
+// adding one takes a key share lock on the channel for its foreign key.
+func (r *Repository) LeaveChannel(ctx context.Context, channelID, userID string) error {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	err = tx.QueryRow(ctx, `SELECT TRUE FROM channels WHERE id = $1 FOR UPDATE`, channelID).Scan(&locked)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrChannelNotFound
+		}
+		return fmt.Errorf("failed to lock channel: %w", err)
+	}
+
+	var role string
+	var count int
+	query := `
+		SELECT COALESCE(m.role, 'member'), (SELECT COUNT(*) FROM channel_members WHERE channel_id = $1)
+		FROM channel_members m
+		WHERE m.channel_id = $1 AND m.user_id = $2
+	`
+	if err := tx.QueryRow(ctx, query, channelID, userID).Scan(&role, &count); err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrNotChannelMember
+		}
+		return fmt.Errorf("failed to get member role: %w", err)
+	}
+	if role == RoleOwner && count > 1 {
+		return ErrOwnerCannotLeave
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM channel_members WHERE channel_id = $1 AND user_id = $2`, channelID, userID); err != nil {
+		return fmt.Errorf("failed to remove channel member: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit leaving channel: %w", err)
+	}
+
+	r.unindexMembership(ctx, userID, channelID)
+	return nil
+}
+
+// ListMembers returns a channel's members in join order
+func (r *Repository) ListMembers(ctx context.Context, channelID string) ([]ChannelMember, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT m.channel_id, m.user_id, COALESCE(u.username, ''), m.joined_at, COALESCE(m.role, 'member')
+		FROM channel_members m
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE m.channel_id = $1
+		ORDER BY m.joined_at ASC, m.user_id ASC
+	`
+
+	rows, err := pool.Query(ctx, query, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channel members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []ChannelMember{}
+	for rows.Next() {
+		var member ChannelMember
+		err := rows.Scan(
+			&member.ChannelID,
+			&member.UserID,
+			&member.Username,
+			&member.JoinedAt,
+			&member.Role,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan channel member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating channel members: %w", err)
+	}
+
+	return members, nil
+}
+
+// ListUserChannels returns every channel the user belongs to, with the
+// user's role, optionally filtered by type. Channels are found through the
+// user's channel index.
+func (r *Repository) ListUserChannels(ctx context.Context, userID, channelType string) ([]Channel, error) {
+	indexed, err := r.listIndexedChannels(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := []Channel{}
+	for _, channel := range indexed {
+		if channelType == "" || channel.Type == channelType {
+			channels = append(channels, channel)
+		}
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].UpdatedAt.After(channels[j].UpdatedAt)
+	})
+
+	return channels, nil
+}
+
+// ListPublicChannels returns public channels ordered by name, starting after
+// the given channel ID cursor. Each shard returns its first page and the
+// results are merged.
+func (r *Repository) ListPublicChannels(ctx context.Context, after string, limit int) ([]Channel, error) {
+	afterName := ""
+	if after != "" {
+		channel, err := r.GetChannel(ctx, after)
+		if err != nil {
+			return nil, ErrChannelNotFound
+		}
+		afterName = channel.Name
+	}
+
+	query := `
+		SELECT id, name, type, created_by, created_at, updated_at, ''
+		FROM channels
+		WHERE type = 'public' AND ($1 = '' OR (name, id::text) > ($1, $2))
+		ORDER BY name, id
+		LIMIT $3
+	`
+
+	channels, err := r.queryChannelsOnAllShards(ctx, query, afterName, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Name != channels[j].Name {
+			return channels[i].Name < channels[j].Name
+		}
+		return channels[i].ID < channels[j].ID
+	})
+	if len(channels) > limit {
+		channels = channels[:limit]
+	}
+
+	return channels, nil
+}
+
+// queryChannelsOnAllShards runs a channel query on every shard and merges the
+// rows, skipping duplicates from shards that share a database
+func (r *Repository) queryChannelsOnAllShards(ctx context.Context, query string, args ...interface{}) ([]Channel, error) {
+	seen := make(map[string]bool)
+	channels := []Channel{}
+
+	for i, pool := range r.db.Shards() {
+		rows, err := pool.Query(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query channels on shard %d: %w", i, err)
+		}
+
+		for rows.Next() {
+			var channel Channel
+			err := rows.Scan(
+				&channel.ID,
+				&channel.Name,
+				&channel.Type,
+				&channel.CreatedBy,
+				&channel.CreatedAt,
+				&channel.UpdatedAt,
+				&channel.Role,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan channel: %w", err)
+			}
+			if !seen[channel.ID] {
+				seen[channel.ID] = true
+				channels = append(channels, channel)
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating channels on shard %d: %w", i, err)
+		}
+	}
+
+	return channels, nil
+}
+
+// mapForeignKeyError turns a violated foreign key into the not-found error
+// for the missing channel or user
+func mapForeignKeyError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		if strings.Contains(pgErr.ConstraintName, "channel_id") {
+			return ErrChannelNotFound
+		}
+		return ErrUserNotFound
+	}
+	return err
+}
@@ -0,0 +1,466 @@
+package chat
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxChannelNameLength is the longest channel name accepted, in characters
+const maxChannelNameLength = 80
+
+// CreateChannel creates a channel with the requesting user as its owner
+func (s *Service) CreateChannel(ctx context.Context, req CreateChannelRequest) (*Channel, error) {
+	name := strings.TrimSpace(req.Name)
+
+	// Every member, including the creator, keyed to their role
+	members := map[string]string{req.CreatedBy: RoleOwner}
+	for _, memberID := range req.MemberIDs {
+		if memberID != "" && memberID != req.CreatedBy {
+			members[memberID] = RoleMember
+		}
+	}
+
+	switch req.Type {
+	case ChannelTypePublic, ChannelTypePrivate:
+		if err := validateChannelName(name); err != nil {
+			return nil, err
+		}
+	case ChannelTypeDM:
+		// Direct messages are between equals and are named by their members
+		if len(members) != 2 {
+			return nil, ErrInvalidDMMembers
+		}
+		members[req.CreatedBy] = RoleMember
+		name = ""
+	default:
+		return nil, ErrInvalidChannelType
+	}
+
+	channel := &Channel{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Type:      req.Type,
+		CreatedBy: req.CreatedBy,
+	}
+	if err := s.repository.CreateChannel(ctx, channel, members); err != nil {
+		return nil, err
+	}
+	channel.Role = members[req.CreatedBy]
+
+	for memberID, role := range members {
+		memberView := *channel
+		memberView.Role = role
+		s.publishEvent(ctx, UserEventsTopic(memberID), EventChannelJoined, ChannelEvent{
+			Channel: memberView,
+			ActorID: req.CreatedBy,
+		}, &channel.ID)
+	}
+
+	return channel, nil
+}
+
+// GetChannelForUser returns a channel the user belongs to, or any public channel
+func (s *Service) GetChannelForUser(ctx context.Context, channelID, userID string) (*Channel, error) {
+	grant, err := s.policy.Authorize(ctx, channelID, userID, ActionViewChannel)
+	if err != nil {
+		return nil, err
+	}
+	return grant.Channel, nil
+}
+
+// ListChannels lists the user's channels, or the public channel directory
+func (s *Service) ListChannels(ctx context.Context, req ChannelListRequest) ([]Channel, error) {
+	if req.Scope == "public" {
+		limit := req.Limit
+		if limit <= 0 || limit > 200 {
+			limit = 50
+		}
+		return s.repository.ListPublicChannels(ctx, req.After, limit)
+	}
+
+	if req.Type != "" && req.Type != ChannelTypePublic && req.Type != ChannelTypePrivate && req.Type != ChannelTypeDM {
+		return nil, ErrInvalidChannelType
+	}
+	return s.repository.ListUserChannels(ctx, req.UserID, req.Type)
+}
+
+// RenameChannel renames a public or private channel
+func (s *Service) RenameChannel(ctx context.Context, channelID, userID, name string) (*Channel, error) {
+	name = strings.TrimSpace(name)
+	if err := validateChannelName(name); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionRenameChannel); err != nil {
+		return nil, err
+	}
+
+	channel, err := s.repository.RenameChannel(ctx, channelID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishEvent(ctx, ChannelEventsTopic(channelID), EventChannelUpdated, ChannelEvent{
+		Channel: *channel,
+		ActorID: userID,
+	}, &channelID)
+
+	return channel, nil
+}
+
+// DeleteChannel deletes a channel along with its members and messages
+func (s *Service) DeleteChannel(ctx context.Context, channelID, userID string) error {
+	grant, err := s.policy.Authorize(ctx, channelID, userID, ActionDeleteChannel)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repository.DeleteChannel(ctx, channelID); err != nil {
+		return err
+	}
+
+	channel := *grant.Channel
+	channel.Role = ""
+	s.publishEvent(ctx, ChannelEventsTopic(channelID), EventChannelDeleted, ChannelEvent{
+		Channel: channel,
+		ActorID: userID,
+	}, &channelID)
+
+	return nil
+}
+
+// JoinChannel adds the user to a public channel
+func (s *Service) JoinChannel(ctx context.Context, channelID, userID string) (*ChannelMember, error) {
+	channel, err := s.repository.GetChannelForMember(ctx, channelID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if channel.Type != ChannelTypePublic {
+		return nil, ErrChannelTypeMismatch
+	}
+	if channel.Role != "" {
+		return nil, ErrAlreadyMember
+	}
+
+	member, err := s.repository.AddMember(ctx, channelID, userID, RoleMember)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishMembershipAdded(ctx, channel, member, userID)
+	return member, nil
+}
+
+// LeaveChannel removes the user from a channel. The owner may only leave
+// once everyone else has.
+func (s *Service) LeaveChannel(ctx context.Context, channelID, userID string) error {
+	if err := s.repository.LeaveChannel(ctx, channelID, userID); err != nil {
+		return err
+	}
+
+	s.publishMembershipRemoved(ctx, channelID, userID, userID)
+	return nil
+}
+
+// AddMember invites a user to a channel with the member or guest role
+func (s *Service) AddMember(ctx context.Context, channelID, actorID string, req AddMemberRequest) (*ChannelMember, error) {
+	role := req.Role
+	if role == "" {
+		role = RoleMember
+	}
+	if role != RoleMember && role != RoleGuest {
+		return nil, ErrInvalidRole
+	}
+
+	grant, err := s.policy.Authorize(ctx, channelID, actorID, ActionInviteMember)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.repository.AddMember(ctx, channelID, req.UserID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishMembershipAdded(ctx, grant.Channel, member, actorID)
+	return member, nil
+}
+
+// RemoveMember removes another user from a channel. Users may only remove
+// members ranked below them, so the owner can never be removed.
+func (s *Service) RemoveMember(ctx context.Context, channelID, actorID, userID string) error {
+	if actorID == userID {
+		return s.LeaveChannel(ctx, channelID, userID)
+	}
+
+	grant, err := s.policy.Authorize(ctx, channelID, actorID, ActionRemoveMember)
+	if err != nil {
+		return err
+	}
+
+	targetRole, err := s.repository.GetMemberRole(ctx, channelID, userID)
+	if err != nil {
+		return err
+	}
+	if !grant.Outranks(targetRole) {
+		return &PermissionError{Action: ActionRemoveMember, Role: grant.Role}
+	}
+
+	if err := s.repository.RemoveMember(ctx, channelID, userID); err != nil {
+		return err
+	}
+
+	s.publishMembershipRemoved(ctx, channelID, userID, actorID)
+	return nil
+}
+
+// UpdateMemberRole changes another member's role
+func (s *Service) UpdateMemberRole(ctx context.Context, channelID, actorID, userID, role string) (*ChannelMember, error) {
+	grant, err := s.policy.Authorize(ctx, channelID, actorID, ActionChangeRole)
+	if err != nil {
+		return nil, err
+	}
+
+	currentRole, err := s.repository.GetMemberRole(ctx, channelID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.AuthorizeRoleChange(grant, currentRole, role); err != nil {
+		return nil, err
+	}
+
+	member, err := s.repository.UpdateMemberRole(ctx, channelID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishEvent(ctx, ChannelEventsTopic(channelID), EventMemberUpdated, MemberEvent{
+		ChannelID: channelID,
+		UserID:    userID,
+		Role:      member.Role,
+		ActorID:   actorID,
+	}, &channelID)
+
+	return member, nil
+}
+
+// ListMembers lists a channel's members with their roles
+func (s *Service) ListMembers(ctx context.Context, channelID, userID string) ([]ChannelMember, error) {
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionViewChannel); err != nil {
+		return nil, err
+	}
+	return s.repository.ListMembers(ctx, channelID)
+}
+
+// validateChannelName checks a channel name's length
+func validateChannelName(name string) error {
+	length := utf8.RuneCountInString(name)
+	if length == 0 || length > maxChannelNameLength {
+		return ErrInvalidChannelName
+	}
+	return nil
+}
+
+// publishMembershipAdded announces a new member to the channel and tells the
+// member's own connections to subscribe to it
+func (s *Service) publishMembershipAdded(ctx context.Context, channel *Channel, member *ChannelMember, actorID string) {
+	s.publishEvent(ctx, ChannelEventsTopic(channel.ID), EventMemberJoined, MemberEvent{
+		ChannelID: channel.ID,
+		UserID:    member.UserID,
+		Role:      member.Role,
+		ActorID:   actorID,
+	}, &channel.ID)
+
+	memberView := *channel
+	memberView.Role = member.Role
+	s.publishEvent(ctx, UserEventsTopic(member.UserID), EventChannelJoined, ChannelEvent{
+		Channel: memberView,
+		ActorID: actorID,
+	}, &channel.ID)
+}
+
+// publishMembershipRemoved announces a departed member to the channel and
+// tells the member's own connections to drop it
+func (s *Service) publishMembershipRemoved(ctx context.Context, channelID, userID, actorID string) {
+	event := MemberEvent{
+		ChannelID: channelID,
+		UserID:    userID,
+		ActorID:   actorID,
+	}
+	s.publishEvent(ctx, ChannelEventsTopic(channelID), EventMemberLeft, event, &channelID)
+	s.publishEvent(ctx, UserEventsTopic(userID), EventChannelLeft, event, &channelID)
+}
+
+// publishEvent publishes a WebSocket event to a Redis topic. Failures are
+// logged rather than returned because the change has already been persisted.
+func (s *Service) publishEvent(ctx context.Context, topic, eventType string, data interface{}, channelID *string) {
+	event := WebSocketEvent{
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Data:      data,
+		ChannelID: channelID,
+	}
+
+	if err := s.publish(ctx, topic, event); err != nil {
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// createChannelHandler handles channel creation
+func (s *Service) createChannelHandler(c *gin.Context) {
+	var req CreateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.CreatedBy = identity.UserID(c)
+
+	channel, err := s.CreateChannel(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, channel)
+}
+
+// listChannelsHandler handles channel listing
+func (s *Service) listChannelsHandler(c *gin.Context) {
+	var req ChannelListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = identity.UserID(c)
+
+	channels, err := s.ListChannels(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"channels": channels})
+}
+
+// getChannelHandler handles channel retrieval
+func (s *Service) getChannelHandler(c *gin.Context) {
+	channel, err := s.GetChannelForUser(c.Request.Context(), c.Param("channel_id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, channel)
+}
+
+// updateChannelHandler handles channel renames
+func (s *Service) updateChannelHandler(c *gin.Context) {
+	var req UpdateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	channel, err := s.RenameChannel(c.Request.Context(), c.Param("channel_id"), identity.UserID(c), req.Name)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, channel)
+}
+
+// deleteChannelHandler handles channel deletion
+func (s *Service) deleteChannelHandler(c *gin.Context) {
+	if err := s.DeleteChannel(c.Request.Context(), c.Param("channel_id"), identity.UserID(c)); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "channel deleted"})
+}
+
+// joinChannelHandler handles joining a public channel
+func (s *Service) joinChannelHandler(c *gin.Context) {
+	member, err := s.JoinChannel(c.Request.Context(), c.Param("channel_id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// leaveChannelHandler handles leaving a channel
+func (s *Service) leaveChannelHandler(c *gin.Context) {
+	if err := s.LeaveChannel(c.Request.Context(), c.Param("channel_id"), identity.UserID(c)); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "left channel"})
+}
+
+// listMembersHandler handles channel member listing
+func (s *Service) listMembersHandler(c *gin.Context) {
+	members, err := s.ListMembers(c.Request.Context(), c.Param("channel_id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// addMemberHandler handles inviting a user to a channel
+func (s *Service) addMemberHandler(c *gin.Context) {
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := s.AddMember(c.Request.Context(), c.Param("channel_id"), identity.UserID(c), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// updateMemberHandler handles changing a member's role
+func (s *Service) updateMemberHandler(c *gin.Context) {
+	var req UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := s.UpdateMemberRole(c.Request.Context(), c.Param("channel_id"), identity.UserID(c), c.Param("user_id"), req.Role)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// removeMemberHandler handles removing a user from a channel
+func (s *Service) removeMemberHandler(c *gin.Context) {
+	err := s.RemoveMember(c.Request.Context(), c.Param("channel_id"), identity.UserID(c), c.Param("user_id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "member removed"})
+}
@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EditMessage replaces a message's content. Authors may edit their own
+// messages while they can still post; moderators may edit anyone's.
+func (s *Service) EditMessage(ctx context.Context, req EditMessageRequest) (*Message, error) {
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	message, err := s.authorizeMessageChange(ctx, req.ChannelID, req.MessageID, req.UserID, ActionEditOthersMessage)
+	if err != nil {
+		return nil, err
+	}
+	if message.Deleted {
+		return nil, ErrMessageDeleted
+	}
+
+	// Saving identical content would only add a pointless revision
+	if message.Content == req.Content {
+		return message, nil
+	}
+
+	message, err = s.repository.EditMessage(ctx, req.ChannelID, req.MessageID, req.UserID, req.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	event := MessageEvent{Message: *message, ChannelID: message.ChannelID}
+	if req.UserID != message.UserID {
+		event.ActorID = req.UserID
+	}
+	s.publishEvent(ctx, ChannelEventsTopic(message.ChannelID), EventMessageUpdated, event, &message.ChannelID)
+
+	return message, nil
+}
+
+// GetMessageRevisions returns the previous versions of a message
+func (s *Service) GetMessageRevisions(ctx context.Context, channelID, messageID, userID string) ([]MessageRevision, error) {
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionReadMessages); err != nil {
+		return nil, err
+	}
+
+	message, err := s.getMessage(ctx, channelID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleted messages keep no visible history
+	if message.Deleted {
+		return []MessageRevision{}, nil
+	}
+
+	return s.repository.ListRevisions(ctx, channelID, messageID)
+}
+
+// authorizeMessageChange loads a message and checks that the user may change
+// it: their own messages need post rights, anyone else's need othersAction
+func (s *Service) authorizeMessageChange(ctx context.Context, channelID, messageID, userID string, othersAction Action) (*Message, error) {
+	grant, err := s.policy.Authorize(ctx, channelID, userID, ActionReadMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.getMessage(ctx, channelID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	action := othersAction
+	if message.UserID == userID {
+		action = ActionPostMessage
+	}
+	if err := s.policy.Evaluate(grant, action); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// getMessage loads a message, translating a missing row to ErrMessageNotFound
+func (s *Service) getMessage(ctx context.Context, channelID, messageID string) (*Message, error) {
+	message, err := s.repository.GetMessage(ctx, messageID, channelID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+// editMessageHandler handles message edits
+func (s *Service) editMessageHandler(c *gin.Context) {
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Set IDs from URL parameters and the editor from the verified identity
+	req.ChannelID = c.Param("channel_id")
+	req.MessageID = c.Param("message_id")
+	req.UserID = identity.UserID(c)
+
+	message, err := s.EditMessage(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+// getMessageRevisionsHandler handles listing a message's previous versions
+func (s *Service) getMessageRevisionsHandler(c *gin.Context) {
+	revisions, err := s.GetMessageRevisions(c.Request.Context(), c.Param("channel_id"), c.Param("message_id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
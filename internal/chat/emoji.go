@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// shortcodePattern matches custom emoji shortcodes such as :party_parrot:
+var shortcodePattern = regexp.MustCompile(`^:[a-z0-9_+-]{1,50}:$`)
+
+// maxEmojiRunes bounds a Unicode emoji, allowing for ZWJ sequences such as
+// family and flag emoji
+const maxEmojiRunes = 16
+
+// Code points that combine with an emoji rather than standing alone
+const (
+	zeroWidthJoiner   = '\u200d'
+	variationSelector = '\ufe0f' // VS16, asking for emoji presentation
+	keycapMark        = '\u20e3'
+	cancelTag         = '\U000e007f'
+)
+
+// runeRange is an inclusive range of code points
+type runeRange struct{ lo, hi rune }
+
+// emojiPictographs are shown as emoji on their own
+var emojiPictographs = []runeRange{
+	{0x231a, 0x231b}, {0x23e9, 0x23ec}, {0x23f0, 0x23f0}, {0x23f3, 0x23f3},
+	{0x25fd, 0x25fe}, {0x2600, 0x27bf}, {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50},
+	{0x2b55, 0x2b55}, {0x1f000, 0x1f1e5}, {0x1f200, 0x1f3fa}, {0x1f400, 0x1faff},
+}
+
+// textPictographs are shown as text unless followed by VS16, so they only
+// count as emoji with it
+var textPictographs = []runeRange{
+	{0x00a9, 0x00a9}, {0x00ae, 0x00ae}, {0x203c, 0x203c}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x2199}, {0x21a9, 0x21aa},
+	{0x2328, 0x2328}, {0x23cf, 0x23cf}, {0x23ed, 0x23ef}, {0x23f1, 0x23f2},
+	{0x23f8, 0x23fa}, {0x24c2, 0x24c2}, {0x25aa, 0x25ab}, {0x25b6, 0x25b6},
+	{0x25c0, 0x25c0}, {0x25fb, 0x25fc}, {0x2934, 0x2935}, {0x2b05, 0x2b07},
+	{0x3030, 0x3030}, {0x303d, 0x303d}, {0x3297, 0x3297}, {0x3299, 0x3299},
+}
+
+// inRanges reports whether r falls in any of ranges
+func inRanges(r rune, ranges []runeRange) bool {
+	for _, rr := range ranges {
+		if r >= rr.lo && r <= rr.hi {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool { return r >= 0x1f1e6 && r <= 0x1f1ff }
+func isSkinTone(r rune) bool          { return r >= 0x1f3fb && r <= 0x1f3ff }
+func isTag(r rune) bool               { return r >= 0xe0020 && r <= 0xe007f }
+func isKeycapBase(r rune) bool        { return r == '#' || r == '*' || (r >= '0' && r <= '9') }
+
+// validateEmoji accepts a custom :shortcode: or a single Unicode emoji: a
+// pictograph with an optional VS16, skin tone or tag sequence, a flag made
+// of two regional indicators, or a keycap, with further pictographs only
+// where a ZWJ joins them
+func validateEmoji(emoji string) error {
+	if shortcodePattern.MatchString(emoji) {
+		return nil
+	}
+	if emoji == "" || !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > maxEmojiRunes {
+		return ErrInvalidEmoji
+	}
+
+	runes := []rune(emoji)
+	i := 0
+	for {
+		n := emojiElement(runes[i:])
+		if n == 0 {
+			return ErrInvalidEmoji
+		}
+		i += n
+		if i == len(runes) {
+			return nil
+		}
+		// Anything after an emoji must be joined to it
+		if runes[i] != zeroWidthJoiner {
+			return ErrInvalidEmoji
+		}
+		i++
+	}
+}
+
+// emojiElement returns the length of the emoji at the start of runes,
+// without any ZWJ that follows it, or 0 if runes does not start with one
+func emojiElement(runes []rune) int {
+	if len(runes) == 0 {
+		return 0
+	}
+
+	switch r := runes[0]; {
+	case isKeycapBase(r):
+		i := 1
+		if i < len(runes) && runes[i] == variationSelector {
+			i++
+		}
+		if i < len(runes) && runes[i] == keycapMark {
+			return i + 1
+		}
+		return 0
+	case isRegionalIndicator(r):
+		if len(runes) >= 2 && isRegionalIndicator(runes[1]) {
+			return 2
+		}
+		return 0
+	case inRanges(r, emojiPictographs), inRanges(r, textPictographs):
+		i := 1
+		if i < len(runes) && runes[i] == variationSelector {
+			i++
+		} else if inRanges(r, textPictographs) {
+			return 0
+		}
+		if i < len(runes) && isSkinTone(runes[i]) {
+			i++
+		}
+		// Tag sequences, as in subdivision flags, end with a cancel tag
+		if i < len(runes) && isTag(runes[i]) {
+			for i < len(runes) && isTag(runes[i]) && runes[i] != cancelTag {
+				i++
+			}
+			if i == len(runes) || runes[i] != cancelTag {
+				return 0
+			}
+			i++
+		}
+		return i
+	}
+	return 0
+}
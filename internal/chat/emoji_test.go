@@ -0,0 +1,61 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		emoji string
+		valid bool
+	}{
+		{"pictograph", "\U0001f600", true},
+		{"dingbat without selector", "❤", true},
+		{"dingbat with selector", "❤\ufe0f", true},
+		{"skin tone", "\U0001f44d\U0001f3fd", true},
+		{"selector and skin tone", "✌\ufe0f\U0001f3fb", true},
+		{"flag", "\U0001f1fa\U0001f1f8", true},
+		{"keycap", "1\ufe0f\u20e3", true},
+		{"keycap without selector", "#\u20e3", true},
+		{"family", "\U0001f468\u200d\U0001f469\u200d\U0001f467", true},
+		{"rainbow flag", "\U0001f3f3\ufe0f\u200d\U0001f308", true},
+		{"health worker", "\U0001f469\U0001f3fd\u200d⚕\ufe0f", true},
+		{"subdivision flag", "\U0001f3f4\U000e0067\U000e0062\U000e0065\U000e006e\U000e0067\U000e007f", true},
+		{"text symbol with selector", "©\ufe0f", true},
+		{"shortcode", ":party_parrot:", true},
+
+		{"empty", "", false},
+		{"three emoji", "\U0001f600\U0001f602\U0001f923", false},
+		{"two flags", "\U0001f1fa\U0001f1f8\U0001f1ec\U0001f1e7", false},
+		{"lone regional indicator", "\U0001f1fa", false},
+		{"copyright", "©", false},
+		{"degree", "°", false},
+		{"box drawing", "─", false},
+		{"caret", "^", false},
+		{"backtick", "`", false},
+		{"diaeresis", "¨", false},
+		{"lone skin tone", "\U0001f3fd", false},
+		{"skin tone before pictograph", "\U0001f3fd\U0001f44d", false},
+		{"letter", "a", false},
+		{"letter and pictograph", "a\U0001f44d", false},
+		{"digit without keycap", "1", false},
+		{"trailing joiner", "\U0001f468\u200d", false},
+		{"leading joiner", "\u200d\U0001f468", false},
+		{"unterminated tag sequence", "\U0001f3f4\U000e0067\U000e0062", false},
+		{"bad shortcode", ":Party Parrot:", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEmoji(tt.emoji)
+			if tt.valid && err != nil {
+				t.Errorf("validateEmoji(%q) = %v, want nil", tt.emoji, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidEmoji) {
+				t.Errorf("validateEmoji(%q) = %v, want ErrInvalidEmoji", tt.emoji, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrChannelNotFound     = errors.New("channel not found")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrNotChannelMember    = errors.New("user is not a member of the channel")
+	ErrAlreadyMember       = errors.New("user is already a member of the channel")
+	ErrForbidden           = errors.New("not allowed to perform this action on the channel")
+	ErrOwnerCannotLeave    = errors.New("channel owner cannot leave while other members remain")
+	ErrInvalidChannelType  = errors.New("channel type must be public, private or dm")
+	ErrInvalidChannelName  = errors.New("channel name must be between 1 and 80 characters")
+	ErrInvalidDMMembers    = errors.New("direct message channels must have exactly one other member")
+	ErrChannelTypeMismatch = errors.New("operation is not supported for this channel type")
+	ErrInvalidRole         = errors.New("role must be admin, member or guest")
+	ErrMessageNotFound     = errors.New("message not found")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrEmptyMessage        = errors.New("message content cannot be empty")
+	ErrMessageDeleted      = errors.New("message has been deleted")
+	ErrInvalidEmoji        = errors.New("emoji must be a single Unicode emoji or a :shortcode:")
+	ErrTooManyReactions    = errors.New("message has reached the limit of distinct reactions")
+	ErrInvalidSearch       = errors.New("search needs a query, a from date before the to date and an offset of at most 1000")
+	ErrUploadNotFound      = errors.New("upload not found")
+	ErrUploadOffset        = errors.New("chunk offset does not match the bytes received")
+	ErrInvalidUpload       = errors.New("upload needs a filename of at most 255 bytes and a size within the limit")
+	ErrChunkTooLarge       = errors.New("chunk exceeds the chunk size limit or the declared upload size")
+	ErrUnsupportedFileType = errors.New("file type is not allowed")
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrTooManyAttachments  = errors.New("message has too many attachments")
+	ErrInvalidDownloadURL  = errors.New("download link is invalid or has expired")
+	ErrInvalidTypingSignal = errors.New("typing signal must be typing_start or typing_stop")
+)
+
+// OffsetError reports a chunk sent at the wrong offset, with the offset the
+// upload should resume from. It matches ErrUploadOffset.
+type OffsetError struct {
+	Offset int64
+}
+
+func (e *OffsetError) Error() string {
+	return ErrUploadOffset.Error()
+}
+
+// Is lets callers test offset failures with errors.Is
+func (e *OffsetError) Is(target error) bool {
+	return target == ErrUploadOffset
+}
+
+// writeError maps service errors to HTTP responses
+func writeError(c *gin.Context, err error) {
+	var permissionErr *PermissionError
+	var offsetErr *OffsetError
+	switch {
+	case errors.As(err, &permissionErr):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  err.Error(),
+			"action": permissionErr.Action,
+			"role":   permissionErr.Role,
+		})
+	case errors.Is(err, ErrChannelNotFound), errors.Is(err, ErrUserNotFound), errors.Is(err, ErrMessageNotFound),
+		errors.Is(err, ErrUploadNotFound), errors.Is(err, ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotChannelMember), errors.Is(err, ErrForbidden), errors.Is(err, ErrInvalidDownloadURL):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.As(err, &offsetErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  err.Error(),
+			"offset": offsetErr.Offset,
+		})
+	case errors.Is(err, ErrAlreadyMember), errors.Is(err, ErrOwnerCannotLeave), errors.Is(err, ErrMessageDeleted),
+		errors.Is(err, ErrTooManyReactions):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrChunkTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUnsupportedFileType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidChannelType), errors.Is(err, ErrInvalidChannelName),
+		errors.Is(err, ErrInvalidDMMembers), errors.Is(err, ErrChannelTypeMismatch),
+		errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidCursor),
+		errors.Is(err, ErrEmptyMessage), errors.Is(err, ErrInvalidEmoji),
+		errors.Is(err, ErrInvalidSearch), errors.Is(err, ErrInvalidUpload),
+		errors.Is(err, ErrTooManyAttachments), errors.Is(err, ErrInvalidTypingSignal):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
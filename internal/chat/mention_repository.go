@@ -0,0 +1,182 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Mentions are stored on the mentioned user's shard, so a user's mentions
+// can be listed without scanning every shard. The messages themselves are
+// then read from the shards of their channels.
+
+// RecordMentions stores the users a message mentions, keyed by user ID with
+// the kind of mention. It returns the users whose mention is new, so a
+// retried send does not notify anyone twice.
+func (r *Repository) RecordMentions(ctx context.Context, message *Message, mentions map[string]string) ([]string, error) {
+	// Group the mentioned users by the shard that owns them
+	byShard := make(map[*pgxpool.Pool][]string)
+	for userID := range mentions {
+		pool := r.db.GetShardByUserID(userID)
+		byShard[pool] = append(byShard[pool], userID)
+	}
+
+	query := `
+		INSERT INTO message_mentions (user_id, message_id, channel_id, mentioned_by, kind, created_at)
+		SELECT mentioned.user_id, $3, $4, $5, mentioned.kind, $6
+		FROM UNNEST($1::uuid[], $2::text[]) AS mentioned (user_id, kind)
+		ON CONFLICT (user_id, message_id) DO NOTHING
+		RETURNING user_id
+	`
+
+	recorded := []string{}
+	for pool, userIDs := range byShard {
+		kinds := make([]string, len(userIDs))
+		for i, userID := range userIDs {
+			kinds[i] = mentions[userID]
+		}
+
+		rows, err := pool.Query(ctx, query, userIDs, kinds, message.ID, message.ChannelID, message.UserID, message.CreatedAt)
+		if err != nil {
+			return recorded, fmt.Errorf("failed to record mentions: %w", err)
+		}
+
+		for rows.Next() {
+			var userID string
+			if err := rows.Scan(&userID); err != nil {
+				rows.Close()
+				return recorded, fmt.Errorf("failed to scan mention: %w", err)
+			}
+			recorded = append(recorded, userID)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return recorded, fmt.Errorf("error iterating mentions: %w", err)
+		}
+	}
+
+	return recorded, nil
+}
+
+// ListMentions returns a page of the user's mentions, newest first, each
+// with its message. Mentions whose message has been deleted, or whose
+// channel the user has left, are left out, so a page may come up short.
+// The cursor is the creation time and message ID of the last mention on the
+// previous page.
+func (r *Repository) ListMentions(ctx context.Context, userID, cursor string, limit int) (*MentionPage, error) {
+	pool := r.db.GetShardByUserID(userID)
+
+	args := []interface{}{userID, limit + 1}
+	cursorCondition := ""
+	if cursor != "" {
+		cursorTime, cursorID, err := r.decodeKeysetCursor(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		cursorCondition = "AND (created_at, message_id) < ($3, $4)"
+		args = append(args, cursorTime, cursorID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT message_id, channel_id, user_id, mentioned_by, kind, created_at
+		FROM message_mentions
+		WHERE user_id = $1 %s
+		ORDER BY created_at DESC, message_id DESC
+		LIMIT $2
+	`, cursorCondition)
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mentions: %w", err)
+	}
+
+	mentions := []Mention{}
+	for rows.Next() {
+		var mention Mention
+		err := rows.Scan(
+			&mention.MessageID,
+			&mention.ChannelID,
+			&mention.UserID,
+			&mention.MentionedBy,
+			&mention.Kind,
+			&mention.CreatedAt,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		mentions = append(mentions, mention)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating mentions: %w", err)
+	}
+
+	page := &MentionPage{Mentions: []Mention{}}
+	if len(mentions) > limit {
+		mentions = mentions[:limit]
+		last := mentions[len(mentions)-1]
+		next := r.encodeKeysetCursor(last.CreatedAt, last.MessageID)
+		page.NextCursor = &next
+		page.HasMore = true
+	}
+
+	messages, err := r.getMentionedMessages(ctx, userID, mentions)
+	if err != nil {
+		return nil, err
+	}
+	for _, mention := range mentions {
+		if message, ok := messages[mention.MessageID]; ok {
+			mention.Message = message
+			page.Mentions = append(page.Mentions, mention)
+		}
+	}
+
+	return page, nil
+}
+
+// getMentionedMessages reads the messages of a page of mentions from the
+// shards of their channels, keyed by message ID. Deleted messages and those
+// in channels the user no longer belongs to are skipped.
+func (r *Repository) getMentionedMessages(ctx context.Context, userID string, mentions []Mention) (map[string]*Message, error) {
+	byShard := make(map[*pgxpool.Pool][]string)
+	for _, mention := range mentions {
+		pool := r.db.GetShardByChannelID(mention.ChannelID)
+		byShard[pool] = append(byShard[pool], mention.MessageID)
+	}
+
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE id = ANY($1::uuid[])
+			AND deleted_at IS NULL
+			AND EXISTS (SELECT 1 FROM channel_members cm WHERE cm.channel_id = messages.channel_id AND cm.user_id = $2)
+	`
+
+	messages := make(map[string]*Message, len(mentions))
+	for pool, messageIDs := range byShard {
+		rows, err := pool.Query(ctx, query, messageIDs, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query mentioned messages: %w", err)
+		}
+
+		for rows.Next() {
+			message, err := scanMessage(rows)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan mentioned message: %w", err)
+			}
+			messages[message.ID] = message
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating mentioned messages: %w", err)
+		}
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,152 @@
+package chat
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mentionToken matches an @ that starts a word, followed by the characters
+// allowed in usernames
+var mentionToken = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.-])@([A-Za-z0-9_.-]+)`)
+
+// parsedMentions is what a message's content mentions, before resolving
+// usernames to members
+type parsedMentions struct {
+	usernames map[string]bool // lower-cased
+	channel   bool
+	here      bool
+}
+
+// parseMentions finds the @username, @channel and @here tokens in content.
+// A trailing '.' or '-' usually ends the sentence rather than the name, so
+// both readings of such a token are kept.
+func parseMentions(content string) parsedMentions {
+	parsed := parsedMentions{usernames: make(map[string]bool)}
+
+	for _, match := range mentionToken.FindAllStringSubmatch(content, -1) {
+		token := strings.ToLower(match[1])
+		trimmed := strings.TrimRight(token, ".-")
+
+		switch trimmed {
+		case "channel":
+			parsed.channel = true
+		case "here":
+			parsed.here = true
+		default:
+			parsed.usernames[token] = true
+			if trimmed != "" {
+				parsed.usernames[trimmed] = true
+			}
+		}
+	}
+
+	return parsed
+}
+
+// notifyMentions records who a new message mentions and sends each of them
+// a mention event on their own topic. The message is already stored, so
+// failures are logged rather than returned.
+func (s *Service) notifyMentions(ctx context.Context, message *Message) {
+	mentions, err := s.resolveMentions(ctx, message)
+	if err != nil {
+		log.Printf("Failed to resolve mentions in message %s: %v", message.ID, err)
+		return
+	}
+	if len(mentions) == 0 {
+		return
+	}
+
+	recorded, err := s.repository.RecordMentions(ctx, message, mentions)
+	if err != nil {
+		log.Printf("Failed to record mentions in message %s: %v", message.ID, err)
+	}
+
+	for _, userID := range recorded {
+		s.publishEvent(ctx, UserEventsTopic(userID), EventMention, MentionEvent{
+			Message:   *message,
+			ChannelID: message.ChannelID,
+			Kind:      mentions[userID],
+		}, &message.ChannelID)
+	}
+}
+
+// resolveMentions maps the members a message mentions to the kind of
+// mention. Unknown usernames and non-members are ignored, @here reaches
+// only members present in the channel, and authors never mention
+// themselves.
+func (s *Service) resolveMentions(ctx context.Context, message *Message) (map[string]string, error) {
+	parsed := parseMentions(message.Content)
+	if len(parsed.usernames) == 0 && !parsed.channel && !parsed.here {
+		return nil, nil
+	}
+
+	members, err := s.repository.ListMembers(ctx, message.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	// @channel already reaches everyone @here would
+	online := make(map[string]bool)
+	if parsed.here && !parsed.channel {
+		present, err := s.redis.GetChannelPresence(ctx, message.ChannelID, time.Now().Add(-s.presence.GetTTL()))
+		if err != nil {
+			// Without presence @here reaches nobody, but direct mentions
+			// still go out
+			log.Printf("Failed to get presence for channel %s: %v", message.ChannelID, err)
+		}
+		for _, userID := range present {
+			online[userID] = true
+		}
+	}
+
+	mentions := make(map[string]string)
+	for _, member := range members {
+		if member.UserID == message.UserID {
+			continue
+		}
+
+		switch {
+		case parsed.usernames[strings.ToLower(member.Username)]:
+			mentions[member.UserID] = MentionUser
+		case parsed.channel:
+			mentions[member.UserID] = MentionChannel
+		case parsed.here && online[member.UserID]:
+			mentions[member.UserID] = MentionHere
+		}
+	}
+
+	return mentions, nil
+}
+
+// ListMentions returns a page of the messages that mention the user, across
+// all of their channels
+func (s *Service) ListMentions(ctx context.Context, userID, cursor string, limit int) (*MentionPage, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	return s.repository.ListMentions(ctx, userID, cursor, limit)
+}
+
+// listMentionsHandler handles listing the caller's mentions
+func (s *Service) listMentionsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	page, err := s.ListMentions(c.Request.Context(), identity.UserID(c), c.Query("cursor"), limit)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -4,23 +4,168 @@ import "time"
 
 // Message represents a chat message
 type Message struct {
-	ID             string    `json:"id" db:"id"`
-	ChannelID      string    `json:"channel_id" db:"channel_id"`
-	UserID         string    `json:"user_id" db:"user_id"`
-	Content        string    `json:"content" db:"content"`
-	MessageType    string    `json:"message_type" db:"message_type"`
-	CreatedAt      time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
-	IdempotencyKey *string   `json:"-" db:"idempotency_key"`
+	ID             string     `json:"id" db:"id"`
+	ChannelID      string     `json:"channel_id" db:"channel_id"`
+	UserID         string     `json:"user_id" db:"user_id"`
+	Content        string     `json:"content" db:"content"`
+	MessageType    string     `json:"message_type" db:"message_type"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+	IdempotencyKey *string    `json:"-" db:"idempotency_key"`
+	Deleted        bool       `json:"deleted"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+
+	// Threads: replies carry their parent's ID; parents carry reply stats
+	ParentID          *string    `json:"parent_id,omitempty" db:"parent_id"`
+	ReplyCount        int        `json:"reply_count" db:"reply_count"`
+	LastReplyAt       *time.Time `json:"last_reply_at,omitempty" db:"last_reply_at"`
+	AlsoSentToChannel bool       `json:"also_sent_to_channel,omitempty" db:"also_sent_to_channel"`
+
+	Reactions   []ReactionSummary `json:"reactions,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+}
+
+// Attachment is an uploaded file in a channel. It is pending until a
+// message it is sent with claims it.
+type Attachment struct {
+	ID          string    `json:"id"`
+	ChannelID   string    `json:"channel_id"`
+	MessageID   *string   `json:"message_id,omitempty"`
+	UploadedBy  string    `json:"uploaded_by"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	StorageKey  string    `json:"-"`
+
+	// Images get dimensions, a blurhash placeholder and thumbnails once
+	// their preview has been generated
+	Width      *int                  `json:"width,omitempty"`
+	Height     *int                  `json:"height,omitempty"`
+	Blurhash   *string               `json:"blurhash,omitempty"`
+	Thumbnails []AttachmentThumbnail `json:"thumbnails,omitempty"`
+
+	// URL is a short-lived signed download link for the requesting user
+	URL          string     `json:"url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
+
+// AttachmentThumbnail is a scaled-down copy of an image attachment that
+// fits in a square of MaxEdge pixels
+type AttachmentThumbnail struct {
+	MaxEdge     int    `json:"max_edge"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	StorageKey  string `json:"-"`
+	URL         string `json:"url,omitempty"` // signed like the attachment's URL
+}
+
+// AttachmentUpload tracks a resumable upload. Chunks must be sent in order;
+// Offset is the number of bytes received so far.
+type AttachmentUpload struct {
+	ID          string      `json:"id"`
+	ChannelID   string      `json:"channel_id"`
+	UserID      string      `json:"user_id"`
+	Filename    string      `json:"filename"`
+	ContentType string      `json:"content_type,omitempty"`
+	Size        int64       `json:"size"`
+	Offset      int64       `json:"offset"`
+	Parts       int         `json:"-"`
+	CreatedAt   time.Time   `json:"created_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	Attachment  *Attachment `json:"attachment,omitempty"` // set once the upload completes
+}
+
+// CreateUploadRequest starts a resumable attachment upload
+type CreateUploadRequest struct {
+	Filename string `json:"filename" binding:"required"`
+	Size     int64  `json:"size" binding:"required"`
+}
+
+// SearchRequest represents a full-text message search
+type SearchRequest struct {
+	Query       string     `form:"q" binding:"required"`
+	ChannelID   string     `form:"channel_id"`
+	AuthorID    string     `form:"author_id"`
+	MessageType string     `form:"message_type"`
+	From        *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To          *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit       int        `form:"limit"`
+	Offset      int        `form:"offset"`
+	UserID      string     `form:"-"`
+}
+
+// SearchResult is a matching message with its rank and a highlighted
+// snippet. The snippet is HTML: message content is escaped and matches are
+// wrapped in <mark> tags, so clients can render it as it is.
+type SearchResult struct {
+	Message Message `json:"message"`
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchPage represents a page of search results
+type SearchPage struct {
+	Results []SearchResult `json:"results"`
+	HasMore bool           `json:"has_more"`
+}
+
+// ReactionSummary aggregates one emoji's reactions on a message
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// AddReactionRequest represents a request to react to a message
+type AddReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// tombstone marks a deleted message and blanks its content so that it can
+// still anchor pagination without exposing what was said
+func (m *Message) tombstone() {
+	if m.DeletedAt != nil {
+		m.Deleted = true
+		m.Content = ""
+	}
 }
 
 // SendMessageRequest represents a request to send a message
 type SendMessageRequest struct {
 	ChannelID      string `json:"channel_id" binding:"required"`
-	UserID         string `json:"user_id" binding:"required"`
+	UserID         string `json:"-"`
 	Content        string `json:"content" binding:"required"`
 	IdempotencyKey string `json:"idempotency_key" binding:"required"`
 	MessageType    string `json:"message_type"`
+
+	// ParentID makes the message a thread reply; AlsoSendToChannel shows
+	// the reply in the channel's history as well
+	ParentID          string `json:"parent_id"`
+	AlsoSendToChannel bool   `json:"also_send_to_channel"`
+
+	// AttachmentIDs lists completed uploads to attach to the message
+	AttachmentIDs []string `json:"attachment_ids"`
+}
+
+// EditMessageRequest represents a request to change a message's content
+type EditMessageRequest struct {
+	ChannelID string `json:"-"`
+	MessageID string `json:"-"`
+	UserID    string `json:"-"`
+	Content   string `json:"content" binding:"required"`
+}
+
+// MessageRevision is a previous version of an edited message
+type MessageRevision struct {
+	MessageID  string    `json:"message_id" db:"message_id"`
+	Revision   int       `json:"revision" db:"revision"`
+	Content    string    `json:"content" db:"content"`
+	EditedBy   string    `json:"edited_by" db:"edited_by"`     // who replaced this version
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`   // when this version was written
+	ReplacedAt time.Time `json:"replaced_at" db:"replaced_at"` // when it was replaced
 }
 
 // MessagePage represents a paginated response of messages
@@ -31,16 +176,39 @@ type MessagePage struct {
 	Total      int       `json:"total"`
 }
 
+// ThreadPage represents a thread root with a page of its replies
+type ThreadPage struct {
+	Parent     Message   `json:"parent"`
+	Replies    []Message `json:"replies"`
+	NextCursor *string   `json:"next_cursor,omitempty"`
+	HasMore    bool      `json:"has_more"`
+}
+
 // HistoryRequest represents a request for message history
 type HistoryRequest struct {
 	ChannelID string     `form:"channel_id" binding:"required"`
-	UserID    string     `form:"user_id" binding:"required"`
+	UserID    string     `form:"-"`
 	Cursor    string     `form:"cursor"`
 	Limit     int        `form:"limit"`
 	Since     *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
 	SinceID   string     `form:"since_id"`
 }
 
+// Channel types
+const (
+	ChannelTypePublic  = "public"
+	ChannelTypePrivate = "private"
+	ChannelTypeDM      = "dm"
+)
+
+// Channel member roles
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleGuest  = "guest" // may read but not post
+)
+
 // Channel represents a chat channel
 type Channel struct {
 	ID        string    `json:"id" db:"id"`
@@ -50,16 +218,135 @@ type Channel struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 	Members   []string  `json:"members,omitempty"`
+	Role      string    `json:"role,omitempty"` // the requesting user's role, when listed for them
 }
 
 // ChannelMember represents a channel membership
 type ChannelMember struct {
 	ChannelID string    `json:"channel_id" db:"channel_id"`
 	UserID    string    `json:"user_id" db:"user_id"`
+	Username  string    `json:"username,omitempty" db:"username"`
 	JoinedAt  time.Time `json:"joined_at" db:"joined_at"`
 	Role      string    `json:"role" db:"role"`
 }
 
+// CreateChannelRequest represents a request to create a channel
+type CreateChannelRequest struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type" binding:"required"`
+	MemberIDs []string `json:"member_ids"`
+	CreatedBy string   `json:"-"`
+}
+
+// UpdateChannelRequest represents a request to rename a channel
+type UpdateChannelRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// AddMemberRequest represents a request to invite a user to a channel
+type AddMemberRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+	Role   string `json:"role"` // defaults to member
+}
+
+// UpdateMemberRequest represents a request to change a member's role
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ChannelListRequest represents a request to list channels
+type ChannelListRequest struct {
+	Scope  string `form:"scope"` // "joined" (default) or "public"
+	Type   string `form:"type"`
+	After  string `form:"after"`
+	Limit  int    `form:"limit"`
+	UserID string `form:"-"`
+}
+
+// ReadReceipt is a user's read watermark in a channel: the newest message
+// they have read
+type ReadReceipt struct {
+	ChannelID         string    `json:"channel_id" db:"channel_id"`
+	UserID            string    `json:"user_id" db:"user_id"`
+	LastReadMessageID string    `json:"last_read_message_id" db:"last_read_message_id"`
+	LastReadAt        time.Time `json:"last_read_at" db:"last_read_at"` // creation time of that message
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// UnreadCount summarises what a user has not yet read in one channel
+type UnreadCount struct {
+	ChannelID         string     `json:"channel_id"`
+	UnreadCount       int        `json:"unread_count"`
+	MentionCount      int        `json:"mention_count"`
+	LastReadMessageID *string    `json:"last_read_message_id,omitempty"`
+	LastReadAt        *time.Time `json:"last_read_at,omitempty"`
+}
+
+// MessagePreview is a shortened view of a channel's latest message
+type MessagePreview struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Content     string    `json:"content"`
+	MessageType string    `json:"message_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// UserChannel is one entry in a user's own channel list
+type UserChannel struct {
+	Channel        Channel         `json:"channel"`
+	LastMessage    *MessagePreview `json:"last_message,omitempty"`
+	UnreadCount    int             `json:"unread_count"`
+	Muted          bool            `json:"muted"`
+	LastActivityAt time.Time       `json:"last_activity_at"`
+}
+
+// UpdateChannelSettingsRequest changes a user's own settings for a channel
+type UpdateChannelSettingsRequest struct {
+	Muted *bool `json:"muted" binding:"required"`
+}
+
+// How a message mentions a user. A user mentioned in several ways gets the
+// most specific one.
+const (
+	MentionUser    = "user"    // @username
+	MentionChannel = "channel" // @channel, every member
+	MentionHere    = "here"    // @here, members online at the time
+)
+
+// Mention records that a message mentioned a user
+type Mention struct {
+	MessageID   string    `json:"message_id"`
+	ChannelID   string    `json:"channel_id"`
+	UserID      string    `json:"user_id"`
+	MentionedBy string    `json:"mentioned_by"`
+	Kind        string    `json:"kind"`
+	CreatedAt   time.Time `json:"created_at"` // when the message was sent
+	Message     *Message  `json:"message,omitempty"`
+}
+
+// MentionPage is a page of the messages that mention a user, newest first
+type MentionPage struct {
+	Mentions   []Mention `json:"mentions"`
+	NextCursor *string   `json:"next_cursor,omitempty"`
+	HasMore    bool      `json:"has_more"`
+}
+
+// OnlinePage is a page of the members currently connected to a channel,
+// most recently seen first
+type OnlinePage struct {
+	UserIDs     []string `json:"user_ids"`
+	OnlineCount int      `json:"online_count"`
+	NextCursor  *string  `json:"next_cursor,omitempty"`
+	HasMore     bool     `json:"has_more"`
+}
+
+// UnreadSummary is the unread state of all of a user's channels
+type UnreadSummary struct {
+	Channels      []UnreadCount `json:"channels"`
+	TotalUnread   int           `json:"total_unread"`
+	TotalMentions int           `json:"total_mentions"`
+}
+
 // User represents a user
 type User struct {
 	ID           string    `json:"id" db:"id"`
@@ -70,6 +357,34 @@ type User struct {
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// WebSocket event types
+const (
+	EventMessage         = "message"
+	EventMessageUpdated  = "message_updated"
+	EventMessageDeleted  = "message_deleted"
+	EventReadReceipt     = "read_receipt"
+	EventThreadReply     = "thread_reply"
+	EventReactionAdded   = "reaction_added"
+	EventReactionRemoved = "reaction_removed"
+	EventChannelUpdated  = "channel_updated"
+	EventChannelDeleted  = "channel_deleted"
+	EventMemberJoined    = "member_joined"
+	EventMemberLeft      = "member_left"
+	EventMemberUpdated   = "member_updated"
+
+	// Sent on a user's own topic when they gain or lose a channel, so their
+	// connections can subscribe to or drop the channel's topic
+	EventChannelJoined = "channel_joined"
+	EventChannelLeft   = "channel_left"
+
+	// Sent on a user's own topic when a message mentions them
+	EventMention = "mention"
+
+	// Ephemeral signals relayed through Redis only; they are never stored
+	EventTypingStart = "typing_start"
+	EventTypingStop  = "typing_stop"
+)
+
 // WebSocketEvent represents an event sent over WebSocket
 type WebSocketEvent struct {
 	Type      string      `json:"type"`
@@ -79,8 +394,62 @@ type WebSocketEvent struct {
 	CallID    *string     `json:"call_id,omitempty"`
 }
 
+// ThreadReplyEvent represents a thread reply event for WebSocket, carrying
+// the root's updated reply stats for thread badges
+type ThreadReplyEvent struct {
+	Message     Message    `json:"message"`
+	ChannelID   string     `json:"channel_id"`
+	ParentID    string     `json:"parent_id"`
+	ReplyCount  int        `json:"reply_count"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+}
+
+// ReactionEvent represents a reaction change event for WebSocket
+type ReactionEvent struct {
+	MessageID string `json:"message_id"`
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"` // the emoji's total after the change
+}
+
+// ChannelEvent represents a channel change event for WebSocket
+type ChannelEvent struct {
+	Channel Channel `json:"channel"`
+	ActorID string  `json:"actor_id,omitempty"`
+}
+
+// MemberEvent represents a membership change event for WebSocket
+type MemberEvent struct {
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	Role      string `json:"role,omitempty"`
+	ActorID   string `json:"actor_id,omitempty"`
+}
+
+// MentionEvent tells a user that a message mentioned them
+type MentionEvent struct {
+	Message   Message `json:"message"`
+	ChannelID string  `json:"channel_id"`
+	Kind      string  `json:"kind"`
+}
+
+// TypingEvent tells channel members that a user started or stopped typing.
+// A started indicator should be hidden at ExpiresAt unless renewed.
+type TypingEvent struct {
+	ChannelID string     `json:"channel_id"`
+	UserID    string     `json:"user_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// TypingRequest is a typing signal sent over HTTP
+type TypingRequest struct {
+	Type string `json:"type" binding:"required"` // typing_start or typing_stop
+}
+
 // MessageEvent represents a message event for WebSocket
 type MessageEvent struct {
 	Message   Message `json:"message"`
 	ChannelID string  `json:"channel_id"`
+	ActorID   string  `json:"actor_id,omitempty"` // the editor, when not the author
 }
@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListOnline returns a page of the channel's members who are connected now.
+// Gateways refresh the presence of every connected member while their
+// connection lasts, so members not refreshed within the presence TTL are
+// treated as gone even before the sweeper removes them. Invisible members
+// are never refreshed, so they are neither listed nor counted.
+func (s *Service) ListOnline(ctx context.Context, channelID, userID, cursor string, limit int) (*OnlinePage, error) {
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionReadMessages); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, err := decodeOffsetCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-s.presence.GetTTL())
+	userIDs, total, err := s.redis.GetChannelPresencePage(ctx, channelID, since, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load channel presence: %w", err)
+	}
+
+	page := &OnlinePage{
+		UserIDs:     userIDs,
+		OnlineCount: int(total),
+		HasMore:     offset+len(userIDs) < int(total),
+	}
+	if page.HasMore {
+		next := encodeOffsetCursor(offset + len(userIDs))
+		page.NextCursor = &next
+	}
+
+	return page, nil
+}
+
+// encodeOffsetCursor encodes a position in a list as an opaque cursor
+func encodeOffsetCursor(offset int) string {
+	return base64.URLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeOffsetCursor decodes a cursor from encodeOffsetCursor; an empty
+// cursor is the start of the list
+func decodeOffsetCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	data, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// listOnlineHandler handles listing the members connected to a channel
+func (s *Service) listOnlineHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	page, err := s.ListOnline(c.Request.Context(), c.Param("channel_id"), identity.UserID(c), c.Query("cursor"), limit)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,157 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+)
+
+// Action is an operation a user may attempt on a channel
+type Action string
+
+// Channel actions governed by the policy
+const (
+	ActionViewChannel         Action = "view_channel"
+	ActionReadMessages        Action = "read_messages"
+	ActionPostMessage         Action = "post_message"
+	ActionReact               Action = "react"
+	ActionEditOthersMessage   Action = "edit_others_message"
+	ActionDeleteOthersMessage Action = "delete_others_message"
+	ActionInviteMember        Action = "invite_member"
+	ActionRemoveMember        Action = "remove_member"
+	ActionRenameChannel       Action = "rename_channel"
+	ActionDeleteChannel       Action = "delete_channel"
+	ActionChangeRole          Action = "change_role"
+	ActionJoinCall            Action = "join_call"
+	ActionEndCall             Action = "end_call"
+)
+
+// roleRank orders roles from least to most privileged. Non-members rank 0.
+var roleRank = map[string]int{
+	RoleGuest:  1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// minimumRole is the least privileged role allowed to perform each action
+var minimumRole = map[Action]string{
+	ActionViewChannel:         RoleGuest,
+	ActionReadMessages:        RoleGuest,
+	ActionPostMessage:         RoleMember,
+	ActionReact:               RoleGuest,
+	ActionEditOthersMessage:   RoleAdmin,
+	ActionDeleteOthersMessage: RoleAdmin,
+	ActionInviteMember:        RoleAdmin,
+	ActionRemoveMember:        RoleAdmin,
+	ActionRenameChannel:       RoleAdmin,
+	ActionDeleteChannel:       RoleOwner,
+	ActionChangeRole:          RoleAdmin,
+	ActionJoinCall:            RoleMember,
+	ActionEndCall:             RoleAdmin,
+}
+
+// PermissionError reports an action the user's role does not allow. It
+// matches ErrForbidden, and ErrNotChannelMember when the user has no role.
+type PermissionError struct {
+	Action Action
+	Role   string
+}
+
+func (e *PermissionError) Error() string {
+	if e.Role == "" {
+		return ErrNotChannelMember.Error()
+	}
+	return fmt.Sprintf("role %s is not allowed to %s", e.Role, e.Action)
+}
+
+// Is lets callers test permission failures with errors.Is
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrForbidden || (e.Role == "" && target == ErrNotChannelMember)
+}
+
+// Grant is the result of a successful authorization
+type Grant struct {
+	Channel *Channel
+	Role    string
+}
+
+// Outranks reports whether the granted role is more privileged than role
+func (g *Grant) Outranks(role string) bool {
+	return roleRank[g.Role] > roleRank[role]
+}
+
+// Policy decides what each channel member may do
+type Policy struct {
+	repository *Repository
+}
+
+// NewPolicy creates a policy evaluator backed by the channel repository
+func NewPolicy(repository *Repository) *Policy {
+	return &Policy{repository: repository}
+}
+
+// Authorize loads the channel and the user's role in it and checks that the
+// role allows the action
+func (p *Policy) Authorize(ctx context.Context, channelID, userID string, action Action) (*Grant, error) {
+	channel, err := p.repository.GetChannelForMember(ctx, channelID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &Grant{Channel: channel, Role: channel.Role}
+	if err := p.Evaluate(grant, action); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// Evaluate checks an action against a role already loaded for a channel
+func (p *Policy) Evaluate(grant *Grant, action Action) error {
+	channel := grant.Channel
+
+	// Direct messages have a fixed pair of members and no name
+	if channel.Type == ChannelTypeDM {
+		switch action {
+		case ActionInviteMember, ActionRemoveMember, ActionRenameChannel, ActionChangeRole:
+			return ErrChannelTypeMismatch
+		}
+	}
+
+	// Anyone may look at a public channel before joining it
+	if channel.Type == ChannelTypePublic && grant.Role == "" && action == ActionViewChannel {
+		return nil
+	}
+
+	required := minimumRole[action]
+
+	// Members may invite others to a public channel, since they could join anyway
+	if action == ActionInviteMember && channel.Type == ChannelTypePublic {
+		required = RoleMember
+	}
+
+	// Nobody owns a direct message, so either member may delete it
+	if action == ActionDeleteChannel && channel.Type == ChannelTypeDM {
+		required = RoleMember
+	}
+
+	if grant.Role == "" || roleRank[grant.Role] < roleRank[required] {
+		return &PermissionError{Action: action, Role: grant.Role}
+	}
+	return nil
+}
+
+// AuthorizeRoleChange checks that the granted user may move a member from
+// one role to another. Users may only manage members below their own role
+// and may only grant roles below their own; ownership cannot be granted.
+func (p *Policy) AuthorizeRoleChange(grant *Grant, fromRole, toRole string) error {
+	if _, ok := roleRank[toRole]; !ok || toRole == RoleOwner {
+		return ErrInvalidRole
+	}
+	if err := p.Evaluate(grant, ActionChangeRole); err != nil {
+		return err
+	}
+	if !grant.Outranks(fromRole) || !grant.Outranks(toRole) {
+		return &PermissionError{Action: ActionChangeRole, Role: grant.Role}
+	}
+	return nil
+}
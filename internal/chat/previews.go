@@ -0,0 +1,216 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"real-time-chat-system/internal/media"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// previewQueue is the Redis list image attachments wait in for their
+// previews; workers in every chat service instance share it
+const previewQueue = "chat:attachment_previews"
+
+const (
+	// previewPollTimeout bounds each wait on the queue, so idle workers
+	// notice shutdown
+	previewPollTimeout = 5 * time.Second
+	// previewTimeout bounds generating a single preview
+	previewTimeout = 2 * time.Minute
+	// maxPreviewAttempts bounds how often a failing preview is retried
+	maxPreviewAttempts = 5
+)
+
+// previewJob identifies an attachment waiting for its preview
+type previewJob struct {
+	ChannelID    string `json:"channel_id"`
+	AttachmentID string `json:"attachment_id"`
+	Attempts     int    `json:"attempts,omitempty"`
+}
+
+// enqueuePreview queues an image attachment for preview generation. Other
+// files have no preview.
+func (s *Service) enqueuePreview(ctx context.Context, attachment *Attachment) {
+	if !media.Supported(attachment.ContentType) {
+		return
+	}
+	s.pushPreviewJob(ctx, previewJob{ChannelID: attachment.ChannelID, AttachmentID: attachment.ID})
+}
+
+// pushPreviewJob adds a job to the back of the preview queue. A failure
+// only costs the preview, so it is logged.
+func (s *Service) pushPreviewJob(ctx context.Context, job previewJob) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("Failed to marshal preview job: %v", err)
+		return
+	}
+	if err := s.redis.LPush(ctx, previewQueue, payload); err != nil {
+		log.Printf("Failed to queue preview for attachment %s: %v", job.AttachmentID, err)
+	}
+}
+
+// RunPreviewWorker generates previews for queued image attachments, one at
+// a time, until ctx is cancelled. Several workers may run at once.
+func (s *Service) RunPreviewWorker(ctx context.Context) {
+	for {
+		result, err := s.redis.BRPop(ctx, previewPollTimeout, previewQueue)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, goredis.Nil) {
+				continue
+			}
+
+			log.Printf("Failed to read preview queue: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		// BRPop returns the list name followed by the value
+		var job previewJob
+		if err := json.Unmarshal([]byte(result[1]), &job); err != nil {
+			log.Printf("Dropping malformed preview job: %v", err)
+			continue
+		}
+
+		s.runPreviewJob(ctx, job)
+	}
+}
+
+// runPreviewJob generates a single preview. Decoding untrusted images is
+// where a panic is most likely, so one is recovered and logged rather than
+// taking the service down.
+func (s *Service) runPreviewJob(ctx context.Context, job previewJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic generating preview for attachment %s: %v", job.AttachmentID, r)
+		}
+	}()
+
+	jobCtx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	err := s.generatePreview(jobCtx, job)
+	if err == nil {
+		return
+	}
+	log.Printf("Failed to generate preview for attachment %s: %v", job.AttachmentID, err)
+
+	// Images that cannot be decoded fail the same way every time; anything
+	// else, such as storage or database errors, is retried
+	if errors.Is(err, media.ErrUnsupportedFormat) || errors.Is(err, media.ErrTooLarge) {
+		return
+	}
+	if job.Attempts+1 >= maxPreviewAttempts {
+		log.Printf("Giving up on preview for attachment %s after %d attempts", job.AttachmentID, job.Attempts+1)
+		return
+	}
+	job.Attempts++
+	// The job is put back even when the worker is shutting down, so
+	// another instance picks it up
+	s.pushPreviewJob(context.WithoutCancel(ctx), job)
+}
+
+// generatePreview stores an image attachment's thumbnails and records its
+// dimensions and blurhash. The original was stripped of its metadata when
+// the upload completed, so the thumbnails carry none either. If the
+// attachment has already been sent, its message is republished as updated.
+// Attachments that are gone or already have a preview are skipped.
+func (s *Service) generatePreview(ctx context.Context, job previewJob) error {
+	attachment, err := s.repository.GetAttachment(ctx, job.ChannelID, job.AttachmentID)
+	if err != nil {
+		if errors.Is(err, ErrAttachmentNotFound) {
+			return nil
+		}
+		return err
+	}
+	if attachment.Blurhash != nil {
+		return nil
+	}
+
+	content, err := s.blobs.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to open attachment: %w", err)
+	}
+	original, err := io.ReadAll(content)
+	content.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	preview, err := media.Generate(original, s.config.Attachments.GetThumbnailSizes(), s.config.Attachments.GetMaxImagePixels())
+	if err != nil {
+		return err
+	}
+
+	for _, thumbnail := range preview.Thumbnails {
+		key := thumbnailKey(attachment.ChannelID, attachment.ID, thumbnail.MaxEdge)
+		if err := s.blobs.Put(ctx, key, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), thumbnail.ContentType); err != nil {
+			return fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+		attachment.Thumbnails = append(attachment.Thumbnails, AttachmentThumbnail{
+			MaxEdge:     thumbnail.MaxEdge,
+			Width:       thumbnail.Width,
+			Height:      thumbnail.Height,
+			ContentType: thumbnail.ContentType,
+			Size:        int64(len(thumbnail.Data)),
+			StorageKey:  key,
+		})
+	}
+
+	attachment.Width = &preview.Width
+	attachment.Height = &preview.Height
+	attachment.Blurhash = &preview.Blurhash
+
+	saved, err := s.repository.SavePreview(ctx, attachment)
+	if err != nil || !saved {
+		return err
+	}
+
+	// Attachments still pending get their preview when they are sent
+	if attachment.MessageID != nil {
+		s.publishPreviewUpdate(ctx, attachment.ChannelID, *attachment.MessageID)
+	}
+
+	return nil
+}
+
+// publishPreviewUpdate republishes a message whose attachment previews have
+// changed, so clients can swap in the thumbnails
+func (s *Service) publishPreviewUpdate(ctx context.Context, channelID, messageID string) {
+	message, err := s.getMessage(ctx, channelID, messageID)
+	if err != nil {
+		log.Printf("Failed to load message %s for preview update: %v", messageID, err)
+		return
+	}
+	if message.Deleted {
+		return
+	}
+
+	messages := []Message{*message}
+	if err := s.repository.attachAttachments(ctx, channelID, messages); err != nil {
+		log.Printf("Failed to load attachments of message %s for preview update: %v", messageID, err)
+		return
+	}
+
+	s.publishEvent(ctx, ChannelEventsTopic(channelID), EventMessageUpdated,
+		MessageEvent{Message: messages[0], ChannelID: channelID}, &channelID)
+}
+
+// thumbnailKey is the blob key of one of an attachment's thumbnails
+func thumbnailKey(channelID, attachmentID string, maxEdge int) string {
+	return "thumbnails/" + channelID + "/" + attachmentID + "/" + strconv.Itoa(maxEdge)
+}
@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AddReaction records a user's reaction on a message. A message may carry
+// at most maxDistinct different emoji; reacting with one already present is
+// always allowed. The returned flag is false when the user had already
+// reacted with this emoji. count is the emoji's total after the change.
+func (r *Repository) AddReaction(ctx context.Context, channelID, messageID, userID, emoji string, maxDistinct int) (count int, added bool, err error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the message so concurrent reactions cannot overshoot the limit
+	var deleted bool
+	lockQuery := `SELECT deleted_at IS NOT NULL FROM messages WHERE id = $1 AND channel_id = $2 FOR UPDATE`
+	if err := tx.QueryRow(ctx, lockQuery, messageID, channelID).Scan(&deleted); err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, false, ErrMessageNotFound
+		}
+		return 0, false, fmt.Errorf("failed to lock message: %w", err)
+	}
+	if deleted {
+		return 0, false, ErrMessageDeleted
+	}
+
+	var present bool
+	var distinct int
+	statsQuery := `
+		SELECT COALESCE(BOOL_OR(emoji = $2), FALSE), COUNT(DISTINCT emoji)
+		FROM message_reactions
+		WHERE message_id = $1
+	`
+	if err := tx.QueryRow(ctx, statsQuery, messageID, emoji).Scan(&present, &distinct); err != nil {
+		return 0, false, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	if !present && distinct >= maxDistinct {
+		return 0, false, ErrTooManyReactions
+	}
+
+	insertQuery := `
+		INSERT INTO message_reactions (message_id, channel_id, user_id, emoji, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING
+	`
+	tag, err := tx.Exec(ctx, insertQuery, messageID, channelID, userID, emoji)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to add reaction: %w", mapForeignKeyError(err))
+	}
+
+	count, err = countReactions(ctx, tx, messageID, emoji)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, fmt.Errorf("failed to commit reaction: %w", err)
+	}
+
+	return count, tag.RowsAffected() > 0, nil
+}
+
+// RemoveReaction removes a user's reaction from a message. The returned flag
+// is false when there was nothing to remove. count is the emoji's remaining total.
+func (r *Repository) RemoveReaction(ctx context.Context, channelID, messageID, userID, emoji string) (count int, removed bool, err error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		DELETE FROM message_reactions
+		WHERE message_id = $1 AND channel_id = $2 AND user_id = $3 AND emoji = $4
+	`
+	tag, err := pool.Exec(ctx, query, messageID, channelID, userID, emoji)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	count, err = countReactions(ctx, pool, messageID, emoji)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return count, tag.RowsAffected() > 0, nil
+}
+
+// attachReactions fills in per-emoji reaction counts on a page of messages,
+// flagging the emoji the given user reacted with. Emoji are ordered by when
+// they were first used. Deleted messages keep no reactions.
+func (r *Repository) attachReactions(ctx context.Context, channelID string, messages []Message, userID string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(messages))
+	messageIDs := make([]string, 0, len(messages))
+	for i, message := range messages {
+		if message.Deleted {
+			continue
+		}
+		index[message.ID] = i
+		messageIDs = append(messageIDs, message.ID)
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2)
+		FROM message_reactions
+		WHERE message_id = ANY($1::uuid[])
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at)
+	`
+
+	rows, err := pool.Query(ctx, query, messageIDs, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var reaction ReactionSummary
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count, &reaction.ReactedByMe); err != nil {
+			return fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		if i, ok := index[messageID]; ok {
+			messages[i].Reactions = append(messages[i].Reactions, reaction)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating reactions: %w", err)
+	}
+
+	return nil
+}
+
+// rowQuerier is satisfied by both pools and transactions
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// countReactions returns how many users reacted to a message with an emoji
+func countReactions(ctx context.Context, q rowQuerier, messageID, emoji string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM message_reactions WHERE message_id = $1 AND emoji = $2`
+	if err := q.QueryRow(ctx, query, messageID, emoji).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AddReaction adds the user's reaction to a message
+func (s *Service) AddReaction(ctx context.Context, channelID, messageID, userID, emoji string) (*ReactionEvent, error) {
+	if err := validateEmoji(emoji); err != nil {
+		return nil, err
+	}
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionReact); err != nil {
+		return nil, err
+	}
+
+	count, added, err := s.repository.AddReaction(ctx, channelID, messageID, userID, emoji, s.config.GetMaxReactionsPerMessage())
+	if err != nil {
+		return nil, err
+	}
+
+	event := &ReactionEvent{
+		MessageID: messageID,
+		ChannelID: channelID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Count:     count,
+	}
+	if added {
+		s.publishEvent(ctx, ChannelEventsTopic(channelID), EventReactionAdded, event, &channelID)
+	}
+
+	return event, nil
+}
+
+// RemoveReaction removes the user's reaction from a message
+func (s *Service) RemoveReaction(ctx context.Context, channelID, messageID, userID, emoji string) (*ReactionEvent, error) {
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionReact); err != nil {
+		return nil, err
+	}
+
+	count, removed, err := s.repository.RemoveReaction(ctx, channelID, messageID, userID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &ReactionEvent{
+		MessageID: messageID,
+		ChannelID: channelID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Count:     count,
+	}
+	if removed {
+		s.publishEvent(ctx, ChannelEventsTopic(channelID), EventReactionRemoved, event, &channelID)
+	}
+
+	return event, nil
+}
+
+// addReactionHandler handles adding a reaction
+func (s *Service) addReactionHandler(c *gin.Context) {
+	var req AddReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reaction, err := s.AddReaction(c.Request.Context(), c.Param("channel_id"), c.Param("message_id"), identity.UserID(c), req.Emoji)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reaction)
+}
+
+// removeReactionHandler handles removing a reaction
+func (s *Service) removeReactionHandler(c *gin.Context) {
+	reaction, err := s.RemoveReaction(c.Request.Context(), c.Param("channel_id"), c.Param("message_id"), identity.UserID(c), c.Param("emoji"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reaction)
+}
@@ -0,0 +1,258 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AdvanceReadState moves a user's read watermark in a channel forward to the
+// given message. A message older than the current watermark leaves it
+// unchanged. The returned flag reports whether the watermark moved.
+func (r *Repository) AdvanceReadState(ctx context.Context, channelID, userID, messageID string) (*ReadReceipt, bool, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	// Watermarks are ordered by (created_at, id) so messages sharing a
+	// timestamp still advance deterministically
+	query := `
+		INSERT INTO channel_read_states (channel_id, user_id, last_read_message_id, last_read_at, updated_at)
+		SELECT channel_id, $2::uuid, id, created_at, NOW()
+		FROM messages
+		WHERE id = $3 AND channel_id = $1
+		ON CONFLICT (channel_id, user_id) DO UPDATE SET
+			last_read_message_id = EXCLUDED.last_read_message_id,
+			last_read_at = EXCLUDED.last_read_at,
+			updated_at = NOW()
+		WHERE (channel_read_states.last_read_at, channel_read_states.last_read_message_id)
+			< (EXCLUDED.last_read_at, EXCLUDED.last_read_message_id)
+		RETURNING channel_id, user_id, last_read_message_id, last_read_at, updated_at
+	`
+
+	var receipt ReadReceipt
+	err := pool.QueryRow(ctx, query, channelID, userID, messageID).Scan(
+		&receipt.ChannelID,
+		&receipt.UserID,
+		&receipt.LastReadMessageID,
+		&receipt.LastReadAt,
+		&receipt.UpdatedAt,
+	)
+	if err == nil {
+		return &receipt, true, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to advance read state: %w", err)
+	}
+
+	// Either the watermark is already past this message or the message does
+	// not exist; the current watermark tells the two apart
+	current, err := r.GetReadState(ctx, channelID, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if current == nil {
+		return nil, false, ErrMessageNotFound
+	}
+	return current, false, nil
+}
+
+// GetReadState returns a user's read watermark in a channel, or nil if the
+// user has not read anything there yet
+func (r *Repository) GetReadState(ctx context.Context, channelID, userID string) (*ReadReceipt, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT channel_id, user_id, last_read_message_id, last_read_at, updated_at
+		FROM channel_read_states
+		WHERE channel_id = $1 AND user_id = $2
+	`
+
+	var receipt ReadReceipt
+	err := pool.QueryRow(ctx, query, channelID, userID).Scan(
+		&receipt.ChannelID,
+		&receipt.UserID,
+		&receipt.LastReadMessageID,
+		&receipt.LastReadAt,
+		&receipt.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get read state: %w", err)
+	}
+
+	return &receipt, nil
+}
+
+// GetUnreadCounts returns unread and mention counts for every channel the
+// user belongs to. Messages count as unread after the user's watermark, or
+// after they joined if they have not read the channel yet; their own and
+// deleted messages are excluded, as are thread replies not also sent to the
+// channel. Mentions are counted from the user's recorded mentions, so they
+// agree with the mentions feed. All shards are queried.
+func (r *Repository) GetUnreadCounts(ctx context.Context, userID string) ([]UnreadCount, error) {
+	query := `
+		SELECT m.channel_id,
+			COUNT(msg.id),
+			rs.last_read_message_id,
+			rs.last_read_at,
+			m.joined_at
+		FROM channel_members m
+		LEFT JOIN channel_read_states rs ON rs.channel_id = m.channel_id AND rs.user_id = m.user_id
+		LEFT JOIN messages msg ON msg.channel_id = m.channel_id
+			AND msg.user_id <> m.user_id
+			AND msg.deleted_at IS NULL
+			AND (msg.parent_id IS NULL OR msg.also_sent_to_channel)
+			AND (msg.created_at, msg.id) > (COALESCE(rs.last_read_at, m.joined_at), COALESCE(rs.last_read_message_id, '00000000-0000-0000-0000-000000000000'::uuid))
+		WHERE m.user_id = $1
+		GROUP BY m.channel_id, rs.last_read_message_id, rs.last_read_at, m.joined_at
+	`
+
+	seen := make(map[string]bool)
+	counts := []UnreadCount{}
+	watermarks := []readWatermark{}
+
+	for i, pool := range r.db.Shards() {
+		rows, err := pool.Query(ctx, query, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query unread counts on shard %d: %w", i, err)
+		}
+
+		for rows.Next() {
+			var count UnreadCount
+			var joinedAt time.Time
+			err := rows.Scan(
+				&count.ChannelID,
+				&count.UnreadCount,
+				&count.LastReadMessageID,
+				&count.LastReadAt,
+				&joinedAt,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan unread count: %w", err)
+			}
+			if seen[count.ChannelID] {
+				continue
+			}
+			seen[count.ChannelID] = true
+			counts = append(counts, count)
+
+			watermark := readWatermark{channelID: count.ChannelID, readAt: joinedAt, messageID: zeroUUID}
+			if count.LastReadAt != nil && count.LastReadMessageID != nil {
+				watermark.readAt = *count.LastReadAt
+				watermark.messageID = *count.LastReadMessageID
+			}
+			watermarks = append(watermarks, watermark)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating unread counts on shard %d: %w", i, err)
+		}
+	}
+
+	mentions, err := r.countUnreadMentions(ctx, userID, watermarks)
+	if err != nil {
+		return nil, err
+	}
+	for i := range counts {
+		counts[i].MentionCount = mentions[counts[i].ChannelID]
+	}
+
+	return counts, nil
+}
+
+// zeroUUID sorts before every message ID, standing in for the message part
+// of a watermark that is only a time
+const zeroUUID = "00000000-0000-0000-0000-000000000000"
+
+// readWatermark is the position in a channel after which messages are
+// unread for a user
+type readWatermark struct {
+	channelID string
+	readAt    time.Time
+	messageID string
+}
+
+// countUnreadMentions counts the user's mentions after each channel's
+// watermark, keyed by channel ID. Mentions are read from the user's shard;
+// those whose messages have since been deleted are then dropped by checking
+// the shards of their channels.
+func (r *Repository) countUnreadMentions(ctx context.Context, userID string, watermarks []readWatermark) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(watermarks) == 0 {
+		return counts, nil
+	}
+
+	channelIDs := make([]string, len(watermarks))
+	readAts := make([]time.Time, len(watermarks))
+	messageIDs := make([]string, len(watermarks))
+	for i, watermark := range watermarks {
+		channelIDs[i] = watermark.channelID
+		readAts[i] = watermark.readAt
+		messageIDs[i] = watermark.messageID
+	}
+
+	query := `
+		SELECT mm.channel_id, mm.message_id
+		FROM message_mentions mm
+		JOIN UNNEST($2::uuid[], $3::timestamptz[], $4::uuid[]) AS w (channel_id, read_at, message_id)
+			ON w.channel_id = mm.channel_id
+		WHERE mm.user_id = $1 AND (mm.created_at, mm.message_id) > (w.read_at, w.message_id)
+	`
+	rows, err := r.db.GetShardByUserID(userID).Query(ctx, query, userID, channelIDs, readAts, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unread mentions: %w", err)
+	}
+
+	// Group the mentioned messages by the shard that owns their channel
+	byShard := make(map[*pgxpool.Pool][]string)
+	for rows.Next() {
+		var channelID, messageID string
+		if err := rows.Scan(&channelID, &messageID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan unread mention: %w", err)
+		}
+		pool := r.db.GetShardByChannelID(channelID)
+		byShard[pool] = append(byShard[pool], messageID)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating unread mentions: %w", err)
+	}
+
+	countQuery := `
+		SELECT channel_id, COUNT(*)
+		FROM messages
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+		GROUP BY channel_id
+	`
+	for pool, ids := range byShard {
+		rows, err := pool.Query(ctx, countQuery, ids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count unread mentions: %w", err)
+		}
+
+		for rows.Next() {
+			var channelID string
+			var count int
+			if err := rows.Scan(&channelID, &count); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan unread mention count: %w", err)
+			}
+			counts[channelID] = count
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating unread mention counts: %w", err)
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,37 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUnreadCounts returns unread and mention counts across all of the
+// user's channels
+func (s *Service) GetUnreadCounts(ctx context.Context, userID string) (*UnreadSummary, error) {
+	counts, err := s.repository.GetUnreadCounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &UnreadSummary{Channels: counts}
+	for _, count := range counts {
+		summary.TotalUnread += count.UnreadCount
+		summary.TotalMentions += count.MentionCount
+	}
+
+	return summary, nil
+}
+
+// getUnreadCountsHandler handles unread count retrieval
+func (s *Service) getUnreadCountsHandler(c *gin.Context) {
+	summary, err := s.GetUnreadCounts(c.Request.Context(), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
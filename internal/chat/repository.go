@@ -4,12 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"real-time-chat-system/internal/database"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -26,16 +28,41 @@ func NewRepository(db *database.PostgresDB) *Repository {
 	}
 }
 
+// messageColumns lists the messages columns read by scanMessage, in order
+const messageColumns = `id, channel_id, user_id, content, message_type, created_at, updated_at, idempotency_key, deleted_at,
+		parent_id, reply_count, last_reply_at, also_sent_to_channel`
+
+// scanMessage scans a row selected with messageColumns, blanking the
+// content of deleted messages
+func scanMessage(row pgx.Row) (*Message, error) {
+	var message Message
+	err := row.Scan(
+		&message.ID,
+		&message.ChannelID,
+		&message.UserID,
+		&message.Content,
+		&message.MessageType,
+		&message.CreatedAt,
+		&message.UpdatedAt,
+		&message.IdempotencyKey,
+		&message.DeletedAt,
+		&message.ParentID,
+		&message.ReplyCount,
+		&message.LastReplyAt,
+		&message.AlsoSentToChannel,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	message.tombstone()
+	return &message, nil
+}
+
 // CreateMessage creates a new message with idempotency support
 func (r *Repository) CreateMessage(ctx context.Context, req SendMessageRequest) (*Message, error) {
 	pool := r.db.GetShardByChannelID(req.ChannelID)
 
-	// Set default message type if not provided
-	messageType := req.MessageType
-	if messageType == "" {
-		messageType = "text"
-	}
-
 	// First, check if message with this idempotency key already exists
 	if req.IdempotencyKey != "" {
 		existingMessage, err := r.getMessageByIdempotencyKey(ctx, pool, req.IdempotencyKey)
@@ -52,7 +79,7 @@ func (r *Repository) CreateMessage(ctx context.Context, req SendMessageRequest)
 	query := `
 		INSERT INTO messages (channel_id, user_id, content, message_type, idempotency_key, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
-		RETURNING id, channel_id, user_id, content, message_type, created_at, updated_at, idempotency_key
+		RETURNING ` + messageColumns + `
 	`
 
 	var idempotencyKey *string
@@ -60,45 +87,54 @@ func (r *Repository) CreateMessage(ctx context.Context, req SendMessageRequest)
 		idempotencyKey = &req.IdempotencyKey
 	}
 
-	var message Message
-	err := pool.QueryRow(ctx, query, req.ChannelID, req.UserID, req.Content, messageType, idempotencyKey).Scan(
-		&message.ID,
-		&message.ChannelID,
-		&message.UserID,
-		&message.Content,
-		&message.MessageType,
-		&message.CreatedAt,
-		&message.UpdatedAt,
-		&message.IdempotencyKey,
-	)
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
+	messageType, err := sendMessageType(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := scanMessage(tx.QueryRow(ctx, query, req.ChannelID, req.UserID, req.Content, messageType, idempotencyKey))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
 
-	return &message, nil
+	if err := linkAttachments(ctx, tx, message, req.AttachmentIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit message: %w", err)
+	}
+
+	return message, nil
+}
+
+// sendMessageType returns the requested message type, defaulting to text,
+// or to image or file for messages carrying attachments
+func sendMessageType(ctx context.Context, q rowQuerier, req SendMessageRequest) (string, error) {
+	if req.MessageType != "" {
+		return req.MessageType, nil
+	}
+	if len(req.AttachmentIDs) > 0 {
+		return attachmentMessageType(ctx, q, req)
+	}
+	return "text", nil
 }
 
 // getMessageByIdempotencyKey retrieves a message by its idempotency key
 func (r *Repository) getMessageByIdempotencyKey(ctx context.Context, pool *pgxpool.Pool, idempotencyKey string) (*Message, error) {
 	query := `
-		SELECT id, channel_id, user_id, content, message_type, created_at, updated_at, idempotency_key
+		SELECT ` + messageColumns + `
 		FROM messages
 		WHERE idempotency_key = $1
 	`
 
-	var message Message
-	err := pool.QueryRow(ctx, query, idempotencyKey).Scan(
-		&message.ID,
-		&message.ChannelID,
-		&message.UserID,
-		&message.Content,
-		&message.MessageType,
-		&message.CreatedAt,
-		&message.UpdatedAt,
-		&message.IdempotencyKey,
-	)
-
+	message, err := scanMessage(pool.QueryRow(ctx, query, idempotencyKey))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, sql.ErrNoRows
@@ -106,7 +142,7 @@ func (r *Repository) getMessageByIdempotencyKey(ctx context.Context, pool *pgxpo
 		return nil, err
 	}
 
-	return &message, nil
+	return message, nil
 }
 
 // GetMessageHistory retrieves message history with pagination
@@ -129,11 +165,14 @@ func (r *Repository) GetMessageHistory(ctx context.Context, req HistoryRequest)
 	args = append(args, req.ChannelID)
 	argIndex++
 
+	// Thread replies only appear in the channel when also sent there
+	conditions = append(conditions, "(parent_id IS NULL OR also_sent_to_channel)")
+
 	// Handle cursor-based pagination (cursor represents a timestamp)
 	if req.Cursor != "" {
 		cursorTime, err := r.decodeCursor(req.Cursor)
 		if err != nil {
-			return nil, fmt.Errorf("invalid cursor: %w", err)
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
 		}
 		conditions = append(conditions, fmt.Sprintf("created_at < $%d", argIndex))
 		args = append(args, cursorTime)
@@ -155,7 +194,7 @@ func (r *Repository) GetMessageHistory(ctx context.Context, req HistoryRequest)
 		err := pool.QueryRow(ctx, sinceQuery, req.SinceID, req.ChannelID).Scan(&sinceTime)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				return nil, fmt.Errorf("since message not found")
+				return nil, fmt.Errorf("since %w", ErrMessageNotFound)
 			}
 			return nil, fmt.Errorf("failed to get since message timestamp: %w", err)
 		}
@@ -179,7 +218,7 @@ func (r *Repository) GetMessageHistory(ctx context.Context, req HistoryRequest)
 	}
 
 	query := fmt.Sprintf(`
-		SELECT id, channel_id, user_id, content, message_type, created_at, updated_at, idempotency_key
+		SELECT `+messageColumns+`
 		FROM messages
 		WHERE %s
 		%s
@@ -196,21 +235,11 @@ func (r *Repository) GetMessageHistory(ctx context.Context, req HistoryRequest)
 
 	var messages []Message
 	for rows.Next() {
-		var message Message
-		err := rows.Scan(
-			&message.ID,
-			&message.ChannelID,
-			&message.UserID,
-			&message.Content,
-			&message.MessageType,
-			&message.CreatedAt,
-			&message.UpdatedAt,
-			&message.IdempotencyKey,
-		)
+		message, err := scanMessage(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
-		messages = append(messages, message)
+		messages = append(messages, *message)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -223,6 +252,14 @@ func (r *Repository) GetMessageHistory(ctx context.Context, req HistoryRequest)
 		messages = messages[:limit] // Remove the extra message
 	}
 
+	// Aggregate reactions for the page, flagging the reader's own
+	if err := r.attachReactions(ctx, req.ChannelID, messages, req.UserID); err != nil {
+		return nil, err
+	}
+	if err := r.attachAttachments(ctx, req.ChannelID, messages); err != nil {
+		return nil, err
+	}
+
 	// Generate next cursor if there are more messages and we're doing pagination (not since filtering)
 	var nextCursor *string
 	if hasMore && len(messages) > 0 && req.Since == nil && req.SinceID == "" {
@@ -231,7 +268,7 @@ func (r *Repository) GetMessageHistory(ctx context.Context, req HistoryRequest)
 	}
 
 	// Get total count for the channel (without filters for performance)
-	totalQuery := `SELECT COUNT(*) FROM messages WHERE channel_id = $1`
+	totalQuery := `SELECT COUNT(*) FROM messages WHERE channel_id = $1 AND (parent_id IS NULL OR also_sent_to_channel)`
 	var total int
 	err = pool.QueryRow(ctx, totalQuery, req.ChannelID).Scan(&total)
 	if err != nil {
@@ -251,23 +288,12 @@ func (r *Repository) GetMessage(ctx context.Context, messageID, channelID string
 	pool := r.db.GetShardByChannelID(channelID)
 
 	query := `
-		SELECT id, channel_id, user_id, content, message_type, created_at, updated_at, idempotency_key
+		SELECT ` + messageColumns + `
 		FROM messages
 		WHERE id = $1 AND channel_id = $2
 	`
 
-	var message Message
-	err := pool.QueryRow(ctx, query, messageID, channelID).Scan(
-		&message.ID,
-		&message.ChannelID,
-		&message.UserID,
-		&message.Content,
-		&message.MessageType,
-		&message.CreatedAt,
-		&message.UpdatedAt,
-		&message.IdempotencyKey,
-	)
-
+	message, err := scanMessage(pool.QueryRow(ctx, query, messageID, channelID))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, sql.ErrNoRows
@@ -275,7 +301,7 @@ func (r *Repository) GetMessage(ctx context.Context, messageID, channelID string
 		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
 
-	return &message, nil
+	return message, nil
 }
 
 // IsChannelMember checks if a user is a member of a channel
@@ -298,6 +324,21 @@ func (r *Repository) IsChannelMember(ctx context.Context, channelID, userID stri
 	return exists, nil
 }
 
+// GetUserChannelIDs returns the IDs of every channel the user belongs to,
+// found through the user's channel index
+func (r *Repository) GetUserChannelIDs(ctx context.Context, userID string) ([]string, error) {
+	channels, err := r.listIndexedChannels(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	channelIDs := make([]string, len(channels))
+	for i, channel := range channels {
+		channelIDs[i] = channel.ID
+	}
+	return channelIDs, nil
+}
+
 // GetChannel retrieves channel information
 func (r *Repository) GetChannel(ctx context.Context, channelID string) (*Channel, error) {
 	pool := r.db.GetShardByChannelID(channelID)
@@ -361,28 +402,14 @@ func (r *Repository) GetMessagesWithCursor(ctx context.Context, channelID, userI
 	return r.GetMessageHistory(ctx, req)
 }
 
-// ValidateMessageFilters validates the filtering parameters
+// ValidateMessageFilters validates the filtering parameters. Access to the
+// channel is checked separately by the policy.
 func (r *Repository) ValidateMessageFilters(ctx context.Context, req HistoryRequest) error {
-	// Validate channel exists
-	_, err := r.GetChannel(ctx, req.ChannelID)
-	if err != nil {
-		return fmt.Errorf("channel not found: %w", err)
-	}
-
-	// Validate user is channel member
-	isMember, err := r.IsChannelMember(ctx, req.ChannelID, req.UserID)
-	if err != nil {
-		return fmt.Errorf("failed to check channel membership: %w", err)
-	}
-	if !isMember {
-		return fmt.Errorf("user is not a member of the channel")
-	}
-
 	// Validate cursor if provided
 	if req.Cursor != "" {
 		_, err := r.decodeCursor(req.Cursor)
 		if err != nil {
-			return fmt.Errorf("invalid cursor: %w", err)
+			return fmt.Errorf("%w: %v", ErrInvalidCursor, err)
 		}
 	}
 
@@ -390,7 +417,10 @@ func (r *Repository) ValidateMessageFilters(ctx context.Context, req HistoryRequ
 	if req.SinceID != "" {
 		_, err := r.GetMessage(ctx, req.SinceID, req.ChannelID)
 		if err != nil {
-			return fmt.Errorf("since message not found: %w", err)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("since %w", ErrMessageNotFound)
+			}
+			return err
 		}
 	}
 
@@ -418,3 +448,32 @@ func (r *Repository) decodeCursor(cursor string) (time.Time, error) {
 
 	return time.Unix(0, timestamp), nil
 }
+
+// encodeKeysetCursor encodes the position of a row ordered by creation time
+// and ID, so rows sharing a timestamp are not skipped between pages
+func (r *Repository) encodeKeysetCursor(t time.Time, id string) string {
+	return base64.URLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixNano(), 10) + ":" + id))
+}
+
+// decodeKeysetCursor decodes a cursor from encodeKeysetCursor into its
+// timestamp and ID
+func (r *Repository) decodeKeysetCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+
+	timestamp, id, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return time.Time{}, "", errors.New("invalid cursor format")
+	}
+	nanos, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor timestamp: %w", err)
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor ID: %w", err)
+	}
+
+	return time.Unix(0, nanos), id, nil
+}
@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EditMessage replaces a message's content, archiving the previous version
+// as a revision in the same transaction
+func (r *Repository) EditMessage(ctx context.Context, channelID, messageID, editorID, content string) (*Message, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the message so concurrent edits are numbered one after another
+	var previousContent string
+	var previousUpdatedAt time.Time
+	lockQuery := `SELECT content, updated_at FROM messages WHERE id = $1 AND channel_id = $2 AND deleted_at IS NULL FOR UPDATE`
+	err = tx.QueryRow(ctx, lockQuery, messageID, channelID).Scan(&previousContent, &previousUpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to lock message: %w", err)
+	}
+
+	archiveQuery := `
+		INSERT INTO message_revisions (message_id, revision, content, edited_by, created_at, replaced_at)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, NOW()
+		FROM message_revisions
+		WHERE message_id = $1
+	`
+	if _, err := tx.Exec(ctx, archiveQuery, messageID, previousContent, editorID, previousUpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to archive message revision: %w", err)
+	}
+
+	updateQuery := `
+		UPDATE messages SET content = $3, updated_at = NOW()
+		WHERE id = $1 AND channel_id = $2
+		RETURNING ` + messageColumns + `
+	`
+
+	message, err := scanMessage(tx.QueryRow(ctx, updateQuery, messageID, channelID, content))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to update message: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit message edit: %w", err)
+	}
+
+	return message, nil
+}
+
+// ListRevisions returns a message's previous versions, oldest first
+func (r *Repository) ListRevisions(ctx context.Context, channelID, messageID string) ([]MessageRevision, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	query := `
+		SELECT rv.message_id, rv.revision, rv.content, rv.edited_by, rv.created_at, rv.replaced_at
+		FROM message_revisions rv
+		JOIN messages m ON m.id = rv.message_id
+		WHERE rv.message_id = $1 AND m.channel_id = $2
+		ORDER BY rv.revision ASC
+	`
+
+	rows, err := pool.Query(ctx, query, messageID, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []MessageRevision{}
+	for rows.Next() {
+		var revision MessageRevision
+		err := rows.Scan(
+			&revision.MessageID,
+			&revision.Revision,
+			&revision.Content,
+			&revision.EditedBy,
+			&revision.CreatedAt,
+			&revision.ReplacedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message revision: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating message revisions: %w", err)
+	}
+
+	return revisions, nil
+}
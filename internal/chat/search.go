@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Search paging bounds. Each shard returns offset+limit rows, so the offset
+// is capped to keep deep pages from scanning too much.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchOffset    = 1000
+)
+
+// SearchMessages searches the messages of every channel the user belongs to
+func (s *Service) SearchMessages(ctx context.Context, req SearchRequest) (*SearchPage, error) {
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		return nil, ErrInvalidSearch
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		return nil, ErrInvalidSearch
+	}
+	if req.Offset < 0 || req.Offset > maxSearchOffset {
+		return nil, ErrInvalidSearch
+	}
+	if req.Limit <= 0 || req.Limit > maxSearchLimit {
+		req.Limit = defaultSearchLimit
+	}
+
+	// Searching a single channel reports a missing membership explicitly
+	if req.ChannelID != "" {
+		if _, err := s.policy.Authorize(ctx, req.ChannelID, req.UserID, ActionReadMessages); err != nil {
+			return nil, err
+		}
+	}
+
+	results, hasMore, err := s.repository.SearchMessages(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchPage{Results: results, HasMore: hasMore}, nil
+}
+
+// searchMessagesHandler handles message search
+func (s *Service) searchMessagesHandler(c *gin.Context) {
+	var req SearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID = identity.UserID(c)
+
+	page, err := s.SearchMessages(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,154 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Matches in search snippets are delimited by these control characters,
+// which are removed from the content first, so that the snippet can be
+// escaped before the delimiters become markup
+const (
+	snippetStartSel = "\x02"
+	snippetStopSel  = "\x03"
+)
+
+// searchConfig is the PostgreSQL text search configuration used for both the
+// content_tsv column and queries; they must match for the index to be used
+const searchConfig = "english"
+
+// SearchMessages runs a full-text search over the channels the user belongs
+// to. Each shard returns its best offset+limit matches, which are merged by
+// rank. When a channel filter is given only that channel's shard is queried.
+func (r *Repository) SearchMessages(ctx context.Context, req SearchRequest) ([]SearchResult, bool, error) {
+	conditions := []string{
+		"content_tsv @@ search_query",
+		"deleted_at IS NULL",
+		"channel_id IN (SELECT channel_id FROM channel_members WHERE user_id = $1)",
+	}
+	args := []interface{}{req.UserID, req.Query}
+	argIndex := 3
+
+	if req.ChannelID != "" {
+		conditions = append(conditions, fmt.Sprintf("channel_id = $%d", argIndex))
+		args = append(args, req.ChannelID)
+		argIndex++
+	}
+	if req.AuthorID != "" {
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", argIndex))
+		args = append(args, req.AuthorID)
+		argIndex++
+	}
+	if req.MessageType != "" {
+		conditions = append(conditions, fmt.Sprintf("message_type = $%d", argIndex))
+		args = append(args, req.MessageType)
+		argIndex++
+	}
+	if req.From != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argIndex))
+		args = append(args, *req.From)
+		argIndex++
+	}
+	if req.To != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", argIndex))
+		args = append(args, *req.To)
+		argIndex++
+	}
+
+	// Fetch one extra row to tell whether another page exists
+	window := req.Offset + req.Limit + 1
+	args = append(args, window)
+
+	query := fmt.Sprintf(`
+		SELECT `+messageColumns+`,
+			ts_rank_cd(content_tsv, search_query) AS rank,
+			ts_headline('%[1]s', translate(content, chr(2) || chr(3), ''), search_query,
+				'StartSel="' || chr(2) || '", StopSel="' || chr(3) || '", MaxFragments=2, MaxWords=20, MinWords=5')
+		FROM messages, websearch_to_tsquery('%[1]s', $2) AS search_query
+		WHERE %[2]s
+		ORDER BY rank DESC, created_at DESC
+		LIMIT $%[3]d
+	`, searchConfig, strings.Join(conditions, " AND "), argIndex)
+
+	pools := r.db.Shards()
+	if req.ChannelID != "" {
+		pools = []*pgxpool.Pool{r.db.GetShardByChannelID(req.ChannelID)}
+	}
+
+	seen := make(map[string]bool)
+	results := []SearchResult{}
+	for i, pool := range pools {
+		rows, err := pool.Query(ctx, query, args...)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to search messages on shard %d: %w", i, err)
+		}
+
+		for rows.Next() {
+			var result SearchResult
+			err := rows.Scan(
+				&result.Message.ID,
+				&result.Message.ChannelID,
+				&result.Message.UserID,
+				&result.Message.Content,
+				&result.Message.MessageType,
+				&result.Message.CreatedAt,
+				&result.Message.UpdatedAt,
+				&result.Message.IdempotencyKey,
+				&result.Message.DeletedAt,
+				&result.Message.ParentID,
+				&result.Message.ReplyCount,
+				&result.Message.LastReplyAt,
+				&result.Message.AlsoSentToChannel,
+				&result.Rank,
+				&result.Snippet,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, false, fmt.Errorf("failed to scan search result: %w", err)
+			}
+			result.Snippet = highlightSnippet(result.Snippet)
+			if !seen[result.Message.ID] {
+				seen[result.Message.ID] = true
+				results = append(results, result)
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, false, fmt.Errorf("error iterating search results on shard %d: %w", i, err)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Message.CreatedAt.After(results[j].Message.CreatedAt)
+	})
+
+	if req.Offset >= len(results) {
+		return []SearchResult{}, false, nil
+	}
+	results = results[req.Offset:]
+
+	hasMore := len(results) > req.Limit
+	if hasMore {
+		results = results[:req.Limit]
+	}
+
+	return results, hasMore, nil
+}
+
+// highlightSnippet turns a ts_headline snippet into HTML: the message text
+// is escaped and matches are wrapped in <mark> tags
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(
+		snippetStartSel, "<mark>",
+		snippetStopSel, "</mark>",
+	).Replace(html.EscapeString(snippet))
+}
@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"real-time-chat-system/internal/blob"
 	"real-time-chat-system/internal/config"
 	"real-time-chat-system/internal/database"
 	"real-time-chat-system/internal/health"
+	"real-time-chat-system/internal/identity"
 	redisclient "real-time-chat-system/internal/redis"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,33 +22,45 @@ import (
 type ChatService interface {
 	SendMessage(ctx context.Context, req SendMessageRequest) (*Message, error)
 	GetMessageHistory(ctx context.Context, req HistoryRequest) (*MessagePage, error)
-	MarkMessageRead(ctx context.Context, req ReadReceiptRequest) error
+	MarkMessageRead(ctx context.Context, req ReadReceiptRequest) (*ReadReceipt, error)
 }
 
-// ReadReceiptRequest represents a read receipt request
+// ReadReceiptRequest represents a read receipt request. All fields come from
+// the URL and the verified identity.
 type ReadReceiptRequest struct {
-	ChannelID string `json:"channel_id" binding:"required"`
-	UserID    string `json:"user_id" binding:"required"`
-	MessageID string `json:"message_id" binding:"required"`
+	ChannelID string `json:"-"`
+	UserID    string `json:"-"`
+	MessageID string `json:"-"`
 }
 
 // Service represents the chat service
 type Service struct {
 	config        *config.ChatConfig
+	presence      *config.PresenceConfig
 	healthChecker *health.Checker
 	db            *database.PostgresDB
 	redis         *redisclient.Client
 	repository    *Repository
+	policy        *Policy
+	signer        *identity.Signer
+	blobs         blob.BlobStore
+	typing        *TypingRelay
 }
 
 // New creates a new Chat service instance
-func New(config *config.ChatConfig, healthChecker *health.Checker, db *database.PostgresDB, redisClient *redisclient.Client) (*Service, error) {
+func New(config *config.ChatConfig, presenceConfig *config.PresenceConfig, healthChecker *health.Checker, db *database.PostgresDB, redisClient *redisclient.Client, signer *identity.Signer, blobs blob.BlobStore) (*Service, error) {
+	repository := NewRepository(db)
 	service := &Service{
 		config:        config,
+		presence:      presenceConfig,
 		healthChecker: healthChecker,
 		db:            db,
 		redis:         redisClient,
-		repository:    NewRepository(db),
+		repository:    repository,
+		policy:        NewPolicy(repository),
+		signer:        signer,
+		blobs:         blobs,
+		typing:        NewTypingRelay(redisClient, config),
 	}
 
 	// Add health check
@@ -57,13 +72,23 @@ func New(config *config.ChatConfig, healthChecker *health.Checker, db *database.
 
 // SendMessage implements the ChatService interface
 func (s *Service) SendMessage(ctx context.Context, req SendMessageRequest) (*Message, error) {
-	// Validate channel membership
-	isMember, err := s.repository.IsChannelMember(ctx, req.ChannelID, req.UserID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check channel membership: %w", err)
+	// Guests and non-members may not post
+	if _, err := s.policy.Authorize(ctx, req.ChannelID, req.UserID, ActionPostMessage); err != nil {
+		return nil, err
 	}
-	if !isMember {
-		return nil, fmt.Errorf("user is not a member of the channel")
+
+	req.AttachmentIDs = uniqueStrings(req.AttachmentIDs)
+	if len(req.AttachmentIDs) > maxAttachmentsPerSend {
+		return nil, ErrTooManyAttachments
+	}
+
+	if req.ParentID != "" {
+		reply, err := s.sendReply(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		s.signMessageAttachments(reply, req.UserID)
+		return reply, nil
 	}
 
 	// Create message with idempotency support
@@ -78,19 +103,32 @@ func (s *Service) SendMessage(ctx context.Context, req SendMessageRequest) (*Mes
 		// In production, you might want to use a retry mechanism or dead letter queue
 		fmt.Printf("Failed to publish message event: %v\n", err)
 	}
+	s.notifyMentions(ctx, message)
 
+	// Download URLs are bound to a user, so only the sender's copy carries
+	// them; other members get theirs when they read the message
+	s.signMessageAttachments(message, req.UserID)
 	return message, nil
 }
 
 // GetMessageHistory implements the ChatService interface
 func (s *Service) GetMessageHistory(ctx context.Context, req HistoryRequest) (*MessagePage, error) {
-	// Validate request parameters and permissions
+	// Validate permissions and request parameters
+	if _, err := s.policy.Authorize(ctx, req.ChannelID, req.UserID, ActionReadMessages); err != nil {
+		return nil, err
+	}
 	if err := s.repository.ValidateMessageFilters(ctx, req); err != nil {
 		return nil, err
 	}
 
 	// Get message history with enhanced filtering
-	return s.repository.GetMessageHistory(ctx, req)
+	page, err := s.repository.GetMessageHistory(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.signAttachmentURLs(page.Messages, req.UserID)
+	return page, nil
 }
 
 // GetMessagesSince retrieves messages created after a specific timestamp
@@ -102,12 +140,21 @@ func (s *Service) GetMessagesSince(ctx context.Context, channelID, userID string
 		Limit:     limit,
 	}
 
-	// Validate request parameters and permissions
+	// Validate permissions and request parameters
+	if _, err := s.policy.Authorize(ctx, req.ChannelID, req.UserID, ActionReadMessages); err != nil {
+		return nil, err
+	}
 	if err := s.repository.ValidateMessageFilters(ctx, req); err != nil {
 		return nil, err
 	}
 
-	return s.repository.GetMessagesSince(ctx, channelID, userID, since, limit)
+	page, err := s.repository.GetMessagesSince(ctx, channelID, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	s.signAttachmentURLs(page.Messages, req.UserID)
+	return page, nil
 }
 
 // GetMessagesSinceID retrieves messages created after a specific message ID
@@ -119,39 +166,67 @@ func (s *Service) GetMessagesSinceID(ctx context.Context, channelID, userID, sin
 		Limit:     limit,
 	}
 
-	// Validate request parameters and permissions
+	// Validate permissions and request parameters
+	if _, err := s.policy.Authorize(ctx, req.ChannelID, req.UserID, ActionReadMessages); err != nil {
+		return nil, err
+	}
 	if err := s.repository.ValidateMessageFilters(ctx, req); err != nil {
 		return nil, err
 	}
 
-	return s.repository.GetMessagesSinceID(ctx, channelID, userID, sinceID, limit)
+	page, err := s.repository.GetMessagesSinceID(ctx, channelID, userID, sinceID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	s.signAttachmentURLs(page.Messages, req.UserID)
+	return page, nil
 }
 
-// MarkMessageRead implements the ChatService interface
-func (s *Service) MarkMessageRead(ctx context.Context, req ReadReceiptRequest) error {
-	// Validate channel membership
-	isMember, err := s.repository.IsChannelMember(ctx, req.ChannelID, req.UserID)
+// MarkMessageRead implements the ChatService interface. It advances the
+// user's read watermark and announces it to the channel when it moves.
+func (s *Service) MarkMessageRead(ctx context.Context, req ReadReceiptRequest) (*ReadReceipt, error) {
+	if _, err := s.policy.Authorize(ctx, req.ChannelID, req.UserID, ActionReadMessages); err != nil {
+		return nil, err
+	}
+
+	receipt, advanced, err := s.repository.AdvanceReadState(ctx, req.ChannelID, req.UserID, req.MessageID)
 	if err != nil {
-		return fmt.Errorf("failed to check channel membership: %w", err)
+		return nil, err
 	}
-	if !isMember {
-		return fmt.Errorf("user is not a member of the channel")
+
+	if advanced {
+		s.publishEvent(ctx, ChannelEventsTopic(req.ChannelID), EventReadReceipt, receipt, &req.ChannelID)
 	}
 
-	// For now, just validate that the message exists
-	// In a full implementation, you would store read receipts
-	_, err = s.repository.GetMessage(ctx, req.MessageID, req.ChannelID)
-	if err != nil {
-		return fmt.Errorf("message not found: %w", err)
+	return receipt, nil
+}
+
+// ChannelEventsTopic returns the Redis pub/sub topic carrying a channel's events
+func ChannelEventsTopic(channelID string) string {
+	return fmt.Sprintf("channel:%s:events", channelID)
+}
+
+// ChannelIDFromTopic returns the channel whose events a topic built by
+// ChannelEventsTopic carries
+func ChannelIDFromTopic(topic string) (string, bool) {
+	channelID, ok := strings.CutPrefix(topic, "channel:")
+	if !ok {
+		return "", false
 	}
+	return strings.CutSuffix(channelID, ":events")
+}
 
-	return nil
+// UserEventsTopic returns the Redis pub/sub topic carrying events addressed to
+// a single user, such as being added to or removed from a channel
+func UserEventsTopic(userID string) string {
+	return fmt.Sprintf("user:%s:events", userID)
 }
 
 // publishMessageEvent publishes a message event to Redis pub/sub
 func (s *Service) publishMessageEvent(ctx context.Context, message *Message) error {
 	event := WebSocketEvent{
-		Type:      "message",
+		Type:      EventMessage,
 		Timestamp: time.Now(),
 		Data: MessageEvent{
 			Message:   *message,
@@ -160,14 +235,18 @@ func (s *Service) publishMessageEvent(ctx context.Context, message *Message) err
 		ChannelID: &message.ChannelID,
 	}
 
+	// Publish to channel-specific topic
+	return s.publish(ctx, ChannelEventsTopic(message.ChannelID), event)
+}
+
+// publish marshals an event and publishes it to a Redis pub/sub topic
+func (s *Service) publish(ctx context.Context, topic string, event WebSocketEvent) error {
 	eventData, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
-	// Publish to channel-specific topic
-	channelTopic := fmt.Sprintf("channel:%s:events", message.ChannelID)
-	if err := s.redis.Publish(ctx, channelTopic, eventData); err != nil {
+	if err := s.redis.Publish(ctx, topic, eventData); err != nil {
 		return fmt.Errorf("failed to publish to Redis: %s", err)
 	}
 
@@ -192,13 +271,48 @@ func (s *Service) Router() http.Handler {
 
 	// Service endpoints
 	v1 := router.Group("/v1")
+	v1.Use(s.signer.Middleware())
 	{
+		v1.POST("/channels", s.createChannelHandler)
+		v1.GET("/channels", s.listChannelsHandler)
+		v1.GET("/channels/:channel_id", s.getChannelHandler)
+		v1.PATCH("/channels/:channel_id", s.updateChannelHandler)
+		v1.DELETE("/channels/:channel_id", s.deleteChannelHandler)
+		v1.POST("/channels/:channel_id/join", s.joinChannelHandler)
+		v1.POST("/channels/:channel_id/leave", s.leaveChannelHandler)
+		v1.GET("/channels/:channel_id/members", s.listMembersHandler)
+		v1.GET("/channels/:channel_id/online", s.listOnlineHandler)
+		v1.POST("/channels/:channel_id/members", s.addMemberHandler)
+		v1.PATCH("/channels/:channel_id/members/:user_id", s.updateMemberHandler)
+		v1.DELETE("/channels/:channel_id/members/:user_id", s.removeMemberHandler)
+
 		v1.POST("/channels/:channel_id/messages", s.sendMessageHandler)
 		v1.GET("/channels/:channel_id/messages", s.getMessagesHandler)
 		v1.GET("/channels/:channel_id/messages/since/:timestamp", s.getMessagesSinceHandler)
 		v1.GET("/channels/:channel_id/messages/since-id/:message_id", s.getMessagesSinceHandler)
+		v1.PATCH("/channels/:channel_id/messages/:message_id", s.editMessageHandler)
+		v1.DELETE("/channels/:channel_id/messages/:message_id", s.deleteMessageHandler)
+		v1.GET("/channels/:channel_id/messages/:message_id/revisions", s.getMessageRevisionsHandler)
+		v1.GET("/channels/:channel_id/messages/:message_id/thread", s.getThreadHandler)
+		v1.POST("/channels/:channel_id/messages/:message_id/reactions", s.addReactionHandler)
+		v1.DELETE("/channels/:channel_id/messages/:message_id/reactions/:emoji", s.removeReactionHandler)
 		v1.POST("/channels/:channel_id/messages/:message_id/read", s.markMessageReadHandler)
+		v1.POST("/channels/:channel_id/typing", s.typingHandler)
+		v1.POST("/channels/:channel_id/uploads", s.createUploadHandler)
+		v1.GET("/channels/:channel_id/uploads/:upload_id", s.getUploadHandler)
+		v1.PUT("/channels/:channel_id/uploads/:upload_id", s.uploadChunkHandler)
+		v1.GET("/channels/:channel_id/attachments/:attachment_id", s.getAttachmentHandler)
+
+		v1.GET("/me/unread", s.getUnreadCountsHandler)
+		v1.GET("/me/channels", s.listMyChannelsHandler)
+		v1.PATCH("/me/channels/:channel_id", s.updateChannelSettingsHandler)
+		v1.GET("/me/mentions", s.listMentionsHandler)
+		v1.GET("/search/messages", s.searchMessagesHandler)
 	}
+
+	// Downloads are authorized by the signed URL rather than identity headers
+	router.GET("/v1/attachments/:attachment_id/content", s.downloadAttachmentHandler)
+
 	return router
 }
 
@@ -218,23 +332,13 @@ func (s *Service) sendMessageHandler(c *gin.Context) {
 		return
 	}
 
-	// Set channel ID from the URL parameter
+	// Set channel ID from the URL parameter and the author from the verified identity
 	req.ChannelID = channelID
-
-	// In a real implementation, we would extract the user_id from the JWT token. Currently using the user_id from the request body
-	if req.UserID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-		return
-	}
+	req.UserID = identity.UserID(c)
 
 	message, err := s.SendMessage(c.Request.Context(), req)
 	if err != nil {
-		if err.Error() == "user is not a member of the channel" {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -257,22 +361,13 @@ func (s *Service) getMessagesHandler(c *gin.Context) {
 		return
 	}
 
-	// Set channel ID from URL parameter
+	// Set channel ID from URL parameter and the reader from the verified identity
 	req.ChannelID = channelID
-
-	// In a real implementation, we would extract user_id from JWT token
-	if req.UserID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-		return
-	}
+	req.UserID = identity.UserID(c)
 
 	messages, err := s.GetMessageHistory(c.Request.Context(), req)
 	if err != nil {
-		if err.Error() == "user is not a member of the channel" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, messages)
@@ -295,12 +390,7 @@ func (s *Service) getMessagesSinceHandler(c *gin.Context) {
 		return
 	}
 
-	// Get query parameters
-	userID := c.Query("user_id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-		return
-	}
+	userID := identity.UserID(c)
 
 	limitStr := c.DefaultQuery("limit", "50")
 	limit, err := strconv.Atoi(limitStr)
@@ -310,11 +400,7 @@ func (s *Service) getMessagesSinceHandler(c *gin.Context) {
 
 	messages, err := s.GetMessagesSince(c.Request.Context(), channelID, userID, since, limit)
 	if err != nil {
-		if err.Error() == "user is not a member of the channel" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -331,12 +417,7 @@ func (s *Service) getMessagesSinceIDHandler(c *gin.Context) {
 		return
 	}
 
-	// Get query parameters
-	userID := c.Query("user_id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-		return
-	}
+	userID := identity.UserID(c)
 
 	limitStr := c.DefaultQuery("limit", "50")
 	limit, err := strconv.Atoi(limitStr)
@@ -346,11 +427,7 @@ func (s *Service) getMessagesSinceIDHandler(c *gin.Context) {
 
 	messages, err := s.GetMessagesSinceID(c.Request.Context(), channelID, userID, sinceID, limit)
 	if err != nil {
-		if err.Error() == "user is not a member of the channel" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -367,33 +444,20 @@ func (s *Service) markMessageReadHandler(c *gin.Context) {
 		return
 	}
 
-	var req ReadReceiptRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Set IDs from URL parameters
-	req.ChannelID = channelID
-	req.MessageID = messageID
-
-	// In a real implementation, you would extract user_id from JWT token
-	if req.UserID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-		return
+	// Set IDs from URL parameters and the reader from the verified identity
+	req := ReadReceiptRequest{
+		ChannelID: channelID,
+		MessageID: messageID,
+		UserID:    identity.UserID(c),
 	}
 
-	err := s.MarkMessageRead(c.Request.Context(), req)
+	receipt, err := s.MarkMessageRead(c.Request.Context(), req)
 	if err != nil {
-		if err.Error() == "user is not a member of the channel" {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "message marked as read"})
+	c.JSON(http.StatusOK, receipt)
 }
 
 // metricHander exposes Prometheus metrics
@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateReply adds a reply to a thread and updates the thread root's reply
+// count and last reply time in the same transaction. Replies to a reply are
+// attached to the root, so threads are one level deep. Returns the reply and
+// the updated root.
+func (r *Repository) CreateReply(ctx context.Context, req SendMessageRequest) (*Message, *Message, error) {
+	pool := r.db.GetShardByChannelID(req.ChannelID)
+
+	// A retried send returns the reply it created the first time
+	if req.IdempotencyKey != "" {
+		existing, err := r.getMessageByIdempotencyKey(ctx, pool, req.IdempotencyKey)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("failed to check idempotency key: %w", err)
+		}
+		if existing != nil {
+			if existing.ParentID == nil {
+				return existing, nil, nil
+			}
+			parent, err := r.GetMessage(ctx, *existing.ParentID, existing.ChannelID)
+			if err != nil {
+				return nil, nil, err
+			}
+			return existing, parent, nil
+		}
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	messageType, err := sendMessageType(ctx, tx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Neither the parent nor the root it belongs to may be deleted. The root
+	// stays locked until commit so it cannot be deleted under the new reply.
+	var rootID string
+	rootQuery := `
+		SELECT root.id
+		FROM messages parent
+		JOIN messages root ON root.id = COALESCE(parent.parent_id, parent.id)
+		WHERE parent.id = $1 AND parent.channel_id = $2
+			AND parent.deleted_at IS NULL AND root.deleted_at IS NULL
+		FOR UPDATE OF root
+	`
+	if err := tx.QueryRow(ctx, rootQuery, req.ParentID, req.ChannelID).Scan(&rootID); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil, fmt.Errorf("parent %w", ErrMessageNotFound)
+		}
+		return nil, nil, fmt.Errorf("failed to get parent message: %w", err)
+	}
+
+	var idempotencyKey *string
+	if req.IdempotencyKey != "" {
+		idempotencyKey = &req.IdempotencyKey
+	}
+
+	insertQuery := `
+		INSERT INTO messages (channel_id, user_id, content, message_type, idempotency_key, parent_id, also_sent_to_channel, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING ` + messageColumns + `
+	`
+	reply, err := scanMessage(tx.QueryRow(ctx, insertQuery,
+		req.ChannelID, req.UserID, req.Content, messageType, idempotencyKey, rootID, req.AlsoSendToChannel))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create reply: %w", err)
+	}
+
+	if err := linkAttachments(ctx, tx, reply, req.AttachmentIDs); err != nil {
+		return nil, nil, err
+	}
+
+	rootUpdateQuery := `
+		UPDATE messages
+		SET reply_count = reply_count + 1,
+			last_reply_at = GREATEST(COALESCE(last_reply_at, $2), $2)
+		WHERE id = $1
+		RETURNING ` + messageColumns + `
+	`
+	root, err := scanMessage(tx.QueryRow(ctx, rootUpdateQuery, rootID, reply.CreatedAt))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update thread root: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit reply: %w", err)
+	}
+
+	return reply, root, nil
+}
+
+// GetThreadReplies returns a page of replies to a thread root, oldest first.
+// The cursor is the creation time and ID of the last reply on the previous
+// page.
+func (r *Repository) GetThreadReplies(ctx context.Context, channelID, parentID, cursor string, limit int) ([]Message, *string, bool, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	args := []interface{}{channelID, parentID, limit + 1}
+	cursorCondition := ""
+	if cursor != "" {
+		cursorTime, cursorID, err := r.decodeKeysetCursor(cursor)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		cursorCondition = "AND (created_at, id) > ($4, $5)"
+		args = append(args, cursorTime, cursorID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE channel_id = $1 AND parent_id = $2 %s
+		ORDER BY created_at ASC, id ASC
+		LIMIT $3
+	`, cursorCondition)
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to query thread replies: %w", err)
+	}
+	defer rows.Close()
+
+	replies := []Message{}
+	for rows.Next() {
+		reply, err := scanMessage(rows)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to scan thread reply: %w", err)
+		}
+		replies = append(replies, *reply)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, false, fmt.Errorf("error iterating thread replies: %w", err)
+	}
+
+	hasMore := len(replies) > limit
+	var nextCursor *string
+	if hasMore {
+		replies = replies[:limit]
+		last := replies[len(replies)-1]
+		next := r.encodeKeysetCursor(last.CreatedAt, last.ID)
+		nextCursor = &next
+	}
+
+	return replies, nextCursor, hasMore, nil
+}
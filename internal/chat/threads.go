@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendReply stores a thread reply and announces it. Thread followers get a
+// thread_reply event; replies also sent to the channel get a message event too.
+// Mentioned users are notified either way.
+func (s *Service) sendReply(ctx context.Context, req SendMessageRequest) (*Message, error) {
+	reply, root, err := s.repository.CreateReply(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// A retried send of a top-level message with a reused key has no thread
+	if root == nil {
+		return reply, nil
+	}
+
+	s.publishEvent(ctx, ChannelEventsTopic(reply.ChannelID), EventThreadReply, ThreadReplyEvent{
+		Message:     *reply,
+		ChannelID:   reply.ChannelID,
+		ParentID:    root.ID,
+		ReplyCount:  root.ReplyCount,
+		LastReplyAt: root.LastReplyAt,
+	}, &reply.ChannelID)
+
+	if reply.AlsoSentToChannel {
+		if err := s.publishMessageEvent(ctx, reply); err != nil {
+			// Log error but don't fail the request - reply was already persisted
+			fmt.Printf("Failed to publish message event: %v\n", err)
+		}
+	}
+	s.notifyMentions(ctx, reply)
+
+	return reply, nil
+}
+
+// GetThread returns a thread root and a page of its replies
+func (s *Service) GetThread(ctx context.Context, channelID, messageID, userID, cursor string, limit int) (*ThreadPage, error) {
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionReadMessages); err != nil {
+		return nil, err
+	}
+
+	root, err := s.getMessage(ctx, channelID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, nextCursor, hasMore, err := s.repository.GetThreadReplies(ctx, channelID, root.ID, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Aggregate reactions on the root and replies together
+	messages := append([]Message{*root}, replies...)
+	if err := s.repository.attachReactions(ctx, channelID, messages, userID); err != nil {
+		return nil, err
+	}
+	if err := s.repository.attachAttachments(ctx, channelID, messages); err != nil {
+		return nil, err
+	}
+	s.signAttachmentURLs(messages, userID)
+	root, replies = &messages[0], messages[1:]
+
+	return &ThreadPage{
+		Parent:     *root,
+		Replies:    replies,
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
+	}, nil
+}
+
+// getThreadHandler handles thread retrieval
+func (s *Service) getThreadHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	thread, err := s.GetThread(c.Request.Context(), c.Param("channel_id"), c.Param("message_id"), identity.UserID(c), c.Query("cursor"), limit)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, thread)
+}
@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeleteMessage tombstones a message. The row is kept so that it still
+// anchors cursors and since_id lookups; its content is purged later.
+func (r *Repository) DeleteMessage(ctx context.Context, channelID, messageID, deletedBy string) (*Message, error) {
+	pool := r.db.GetShardByChannelID(channelID)
+
+	// A deleted reply no longer counts towards its thread root's replies or
+	// last reply time. The subquery sees the rows as they were before this
+	// statement, so the reply being deleted is excluded by ID.
+	query := `
+		WITH deleted AS (
+			UPDATE messages SET deleted_at = NOW(), deleted_by = $3
+			WHERE id = $1 AND channel_id = $2 AND deleted_at IS NULL
+			RETURNING ` + messageColumns + `
+		), root AS (
+			UPDATE messages SET reply_count = GREATEST(messages.reply_count - 1, 0),
+				last_reply_at = (
+					SELECT MAX(reply.created_at)
+					FROM messages reply
+					WHERE reply.parent_id = deleted.parent_id
+						AND reply.deleted_at IS NULL
+						AND reply.id <> deleted.id
+				)
+			FROM deleted
+			WHERE messages.id = deleted.parent_id
+		)
+		SELECT ` + messageColumns + ` FROM deleted
+	`
+
+	message, err := scanMessage(pool.QueryRow(ctx, query, messageID, channelID, deletedBy))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	return message, nil
+}
+
+// PurgeTombstones erases the content and revision history of messages
+// deleted before the cutoff on every shard, returning the number of
+// messages purged
+func (r *Repository) PurgeTombstones(ctx context.Context, cutoff time.Time) (int64, error) {
+	revisionsQuery := `
+		DELETE FROM message_revisions rv
+		USING messages m
+		WHERE rv.message_id = m.id AND m.deleted_at < $1
+	`
+	messagesQuery := `
+		UPDATE messages SET content = ''
+		WHERE deleted_at < $1 AND content <> ''
+	`
+
+	var purged int64
+	for i, pool := range r.db.Shards() {
+		if _, err := pool.Exec(ctx, revisionsQuery, cutoff); err != nil {
+			return purged, fmt.Errorf("failed to purge revisions on shard %d: %w", i, err)
+		}
+
+		tag, err := pool.Exec(ctx, messagesQuery, cutoff)
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge messages on shard %d: %w", i, err)
+		}
+		purged += tag.RowsAffected()
+	}
+
+	return purged, nil
+}
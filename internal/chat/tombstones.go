@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeleteMessage tombstones a message. Authors may delete their own messages
+// while they can still post; moderators may delete anyone's. Deleting an
+// already deleted message returns the existing tombstone.
+func (s *Service) DeleteMessage(ctx context.Context, channelID, messageID, userID string) (*Message, error) {
+	message, err := s.authorizeMessageChange(ctx, channelID, messageID, userID, ActionDeleteOthersMessage)
+	if err != nil {
+		return nil, err
+	}
+	if message.Deleted {
+		return message, nil
+	}
+
+	message, err = s.repository.DeleteMessage(ctx, channelID, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := MessageEvent{Message: *message, ChannelID: message.ChannelID}
+	if userID != message.UserID {
+		event.ActorID = userID
+	}
+	s.publishEvent(ctx, ChannelEventsTopic(message.ChannelID), EventMessageDeleted, event, &message.ChannelID)
+
+	return message, nil
+}
+
+// RunTombstonePurger periodically erases the content and attachments of
+// messages deleted longer ago than the grace period, along with abandoned
+// uploads, until ctx is cancelled
+func (s *Service) RunTombstonePurger(ctx context.Context) {
+	ticker := time.NewTicker(s.config.GetPurgeInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-s.config.GetTombstoneGracePeriod())
+			s.purgeAttachments(ctx, cutoff)
+
+			purged, err := s.repository.PurgeTombstones(ctx, cutoff)
+			if err != nil {
+				log.Printf("Failed to purge deleted messages: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Purged content of %d deleted messages", purged)
+			}
+		}
+	}
+}
+
+// deleteMessageHandler handles message deletion
+func (s *Service) deleteMessageHandler(c *gin.Context) {
+	message, err := s.DeleteMessage(c.Request.Context(), c.Param("channel_id"), c.Param("message_id"), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
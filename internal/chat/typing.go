@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"real-time-chat-system/internal/config"
+	"real-time-chat-system/internal/identity"
+	redisclient "real-time-chat-system/internal/redis"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// TypingRelay relays typing signals to channel members through Redis alone.
+// A user's typing state is a key that expires on its own, so clients that
+// vanish without sending typing_stop do not leave indicators behind. Starts
+// are throttled per user and channel, and a stop is only relayed for a user
+// whose start was, so no client can send more than one start and one stop
+// per throttle interval to a channel.
+type TypingRelay struct {
+	redis    *redisclient.Client
+	ttl      time.Duration
+	throttle time.Duration
+}
+
+// NewTypingRelay creates a relay using the chat service's typing settings
+func NewTypingRelay(redisClient *redisclient.Client, cfg *config.ChatConfig) *TypingRelay {
+	return &TypingRelay{
+		redis:    redisClient,
+		ttl:      cfg.GetTypingTTL(),
+		throttle: cfg.GetTypingThrottle(),
+	}
+}
+
+// Signal relays a typing_start or typing_stop from a user to a channel.
+// authorize is only called for starts that get past the throttle, so
+// callers can check membership without doing so for every keystroke; a
+// stop needs no check because only an authorized start can precede it.
+// Throttled starts and stops from users who are not typing are dropped.
+func (t *TypingRelay) Signal(ctx context.Context, channelID, userID, signal string, authorize func() error) error {
+	switch signal {
+	case EventTypingStart:
+		return t.start(ctx, channelID, userID, authorize)
+	case EventTypingStop:
+		return t.stop(ctx, channelID, userID)
+	default:
+		return ErrInvalidTypingSignal
+	}
+}
+
+// start marks the user as typing and announces it, unless the user's last
+// start in the channel was relayed less than a throttle interval ago
+func (t *TypingRelay) start(ctx context.Context, channelID, userID string, authorize func() error) error {
+	allowed, err := t.redis.SetNX(ctx, typingThrottleKey(channelID, userID), 1, t.throttle)
+	if err != nil {
+		return fmt.Errorf("failed to throttle typing signal: %w", err)
+	}
+	if !allowed {
+		return nil
+	}
+
+	if err := authorize(); err != nil {
+		return err
+	}
+
+	if err := t.redis.Set(ctx, typingKey(channelID, userID), 1, t.ttl); err != nil {
+		return fmt.Errorf("failed to record typing state: %w", err)
+	}
+
+	expiresAt := time.Now().Add(t.ttl)
+	return t.publish(ctx, EventTypingStart, TypingEvent{ChannelID: channelID, UserID: userID, ExpiresAt: &expiresAt})
+}
+
+// stop clears the user's typing state and announces it if they were typing.
+// The throttle is left in place: lifting it would let a client alternating
+// starts and stops have every one of them relayed.
+func (t *TypingRelay) stop(ctx context.Context, channelID, userID string) error {
+	if _, err := t.redis.GetDel(ctx, typingKey(channelID, userID)); err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil
+		}
+		return fmt.Errorf("failed to clear typing state: %w", err)
+	}
+
+	return t.publish(ctx, EventTypingStop, TypingEvent{ChannelID: channelID, UserID: userID})
+}
+
+// publish sends a typing event on the channel's topic
+func (t *TypingRelay) publish(ctx context.Context, eventType string, data TypingEvent) error {
+	event := WebSocketEvent{
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Data:      data,
+		ChannelID: &data.ChannelID,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal typing event: %w", err)
+	}
+	if err := t.redis.Publish(ctx, ChannelEventsTopic(data.ChannelID), payload); err != nil {
+		return fmt.Errorf("failed to publish typing event: %w", err)
+	}
+
+	return nil
+}
+
+// typingKey is the Redis key holding a user's typing state in a channel
+func typingKey(channelID, userID string) string {
+	return fmt.Sprintf("typing:%s:%s", channelID, userID)
+}
+
+// typingThrottleKey is the Redis key throttling a user's typing starts in
+// a channel
+func typingThrottleKey(channelID, userID string) string {
+	return fmt.Sprintf("typing:%s:%s:throttle", channelID, userID)
+}
+
+// SignalTyping relays a typing signal sent over HTTP. Any member may signal
+// typing; membership is checked only for starts the throttle lets through.
+func (s *Service) SignalTyping(ctx context.Context, channelID, userID, signal string) error {
+	return s.typing.Signal(ctx, channelID, userID, signal, func() error {
+		_, err := s.policy.Authorize(ctx, channelID, userID, ActionReadMessages)
+		return err
+	})
+}
+
+// typingHandler handles typing signals from clients without a WebSocket
+func (s *Service) typingHandler(c *gin.Context) {
+	var req TypingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.SignalTyping(c.Request.Context(), c.Param("channel_id"), identity.UserID(c), req.Type); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,371 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxPreviewLength is the longest last-message preview returned, in characters
+const maxPreviewLength = 140
+
+// indexPruneGrace is how old an unmatched index entry must be before readers
+// prune it, so entries written just ahead of their membership survive
+const indexPruneGrace = time.Minute
+
+// The user_channels table indexes memberships by user on the user's shard,
+// so a user's channels can be found without scanning every shard. The index
+// is written before a membership is added and after one is removed, so it
+// only ever lists too many channels, never too few. Readers confirm each
+// entry against channel_members and prune old entries that do not match.
+
+// indexMembership records a membership in the user's channel index. An
+// existing entry keeps its settings but restarts its prune grace period.
+func (r *Repository) indexMembership(ctx context.Context, userID, channelID string) error {
+	pool := r.db.GetShardByUserID(userID)
+
+	query := `
+		INSERT INTO user_channels (user_id, channel_id, muted, created_at)
+		VALUES ($1, $2, FALSE, NOW())
+		ON CONFLICT (user_id, channel_id) DO UPDATE SET created_at = NOW()
+	`
+	if _, err := pool.Exec(ctx, query, userID, channelID); err != nil {
+		return fmt.Errorf("failed to index channel membership: %w", mapForeignKeyError(err))
+	}
+
+	return nil
+}
+
+// unindexMembership drops a membership from the user's channel index. A
+// failure only leaves a stale entry behind, which readers prune, so it is
+// logged rather than returned.
+func (r *Repository) unindexMembership(ctx context.Context, userID, channelID string) {
+	pool := r.db.GetShardByUserID(userID)
+
+	query := `DELETE FROM user_channels WHERE user_id = $1 AND channel_id = $2`
+	if _, err := pool.Exec(ctx, query, userID, channelID); err != nil {
+		log.Printf("Failed to unindex channel %s for user %s: %v", channelID, userID, err)
+	}
+}
+
+// SetChannelMuted changes whether the user has muted a channel
+func (r *Repository) SetChannelMuted(ctx context.Context, userID, channelID string, muted bool) error {
+	pool := r.db.GetShardByUserID(userID)
+
+	query := `UPDATE user_channels SET muted = $3 WHERE user_id = $1 AND channel_id = $2`
+	tag, err := pool.Exec(ctx, query, userID, channelID, muted)
+	if err != nil {
+		return fmt.Errorf("failed to update channel settings: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotChannelMember
+	}
+
+	return nil
+}
+
+// ListUserChannelsWithActivity returns the user's channels with their latest
+// message and unread count, most recently active first. The user's index is
+// read from their shard and only the shards holding those channels are
+// queried.
+func (r *Repository) ListUserChannelsWithActivity(ctx context.Context, userID string) ([]UserChannel, error) {
+	indexed, err := r.getIndexedChannels(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unread counts follow the same rules as GetUnreadCounts
+	query := `
+		SELECT c.id, c.name, c.type, c.created_by, c.created_at, c.updated_at, COALESCE(m.role, 'member'), m.joined_at,
+			last.id, last.user_id, last.content, last.message_type, last.created_at,
+			(
+				SELECT COUNT(*)
+				FROM messages msg
+				WHERE msg.channel_id = c.id
+					AND msg.user_id <> m.user_id
+					AND msg.deleted_at IS NULL
+					AND (msg.parent_id IS NULL OR msg.also_sent_to_channel)
+					AND (msg.created_at, msg.id) > (COALESCE(rs.last_read_at, m.joined_at), COALESCE(rs.last_read_message_id, '00000000-0000-0000-0000-000000000000'::uuid))
+			)
+		FROM channels c
+		JOIN channel_members m ON m.channel_id = c.id AND m.user_id = $1
+		LEFT JOIN channel_read_states rs ON rs.channel_id = c.id AND rs.user_id = m.user_id
+		LEFT JOIN LATERAL (
+			SELECT id, user_id, content, message_type, created_at
+			FROM messages
+			WHERE channel_id = c.id AND deleted_at IS NULL AND (parent_id IS NULL OR also_sent_to_channel)
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		) last ON TRUE
+		WHERE c.id = ANY($2::uuid[])
+	`
+
+	channels := []UserChannel{}
+	found := make(map[string]bool)
+	for pool, channelIDs := range r.groupByShard(indexed) {
+		rows, err := pool.Query(ctx, query, userID, channelIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query user channels: %w", err)
+		}
+
+		for rows.Next() {
+			var entry UserChannel
+			var joinedAt time.Time
+			var lastID, lastUserID, lastContent, lastType *string
+			var lastCreatedAt *time.Time
+			err := rows.Scan(
+				&entry.Channel.ID,
+				&entry.Channel.Name,
+				&entry.Channel.Type,
+				&entry.Channel.CreatedBy,
+				&entry.Channel.CreatedAt,
+				&entry.Channel.UpdatedAt,
+				&entry.Channel.Role,
+				&joinedAt,
+				&lastID,
+				&lastUserID,
+				&lastContent,
+				&lastType,
+				&lastCreatedAt,
+				&entry.UnreadCount,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan user channel: %w", err)
+			}
+
+			entry.Muted = indexed[entry.Channel.ID].muted
+			entry.LastActivityAt = joinedAt
+			if lastID != nil {
+				entry.LastMessage = &MessagePreview{
+					ID:          *lastID,
+					UserID:      *lastUserID,
+					Content:     truncatePreview(*lastContent),
+					MessageType: *lastType,
+					CreatedAt:   *lastCreatedAt,
+				}
+				if lastCreatedAt.After(joinedAt) {
+					entry.LastActivityAt = *lastCreatedAt
+				}
+			}
+
+			found[entry.Channel.ID] = true
+			channels = append(channels, entry)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating user channels: %w", err)
+		}
+	}
+
+	r.pruneIndex(ctx, userID, indexed, found)
+
+	sort.Slice(channels, func(i, j int) bool {
+		if !channels[i].LastActivityAt.Equal(channels[j].LastActivityAt) {
+			return channels[i].LastActivityAt.After(channels[j].LastActivityAt)
+		}
+		return channels[i].Channel.ID < channels[j].Channel.ID
+	})
+
+	return channels, nil
+}
+
+// listIndexedChannels returns every channel the user belongs to, with the
+// user's role. The user's index is read from their shard and only the
+// shards holding those channels are queried.
+func (r *Repository) listIndexedChannels(ctx context.Context, userID string) ([]Channel, error) {
+	indexed, err := r.getIndexedChannels(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT c.id, c.name, c.type, c.created_by, c.created_at, c.updated_at, COALESCE(m.role, 'member')
+		FROM channel_members m
+		JOIN channels c ON c.id = m.channel_id
+		WHERE m.user_id = $1 AND m.channel_id = ANY($2::uuid[])
+	`
+
+	channels := []Channel{}
+	found := make(map[string]bool)
+	for pool, channelIDs := range r.groupByShard(indexed) {
+		rows, err := pool.Query(ctx, query, userID, channelIDs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query user channels: %w", err)
+		}
+
+		for rows.Next() {
+			var channel Channel
+			err := rows.Scan(
+				&channel.ID,
+				&channel.Name,
+				&channel.Type,
+				&channel.CreatedBy,
+				&channel.CreatedAt,
+				&channel.UpdatedAt,
+				&channel.Role,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan channel: %w", err)
+			}
+			if !found[channel.ID] {
+				found[channel.ID] = true
+				channels = append(channels, channel)
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating user channels: %w", err)
+		}
+	}
+
+	r.pruneIndex(ctx, userID, indexed, found)
+	return channels, nil
+}
+
+// groupByShard groups the channels in a user's index by the shard that
+// owns them
+func (r *Repository) groupByShard(indexed map[string]indexEntry) map[*pgxpool.Pool][]string {
+	byShard := make(map[*pgxpool.Pool][]string)
+	for channelID := range indexed {
+		pool := r.db.GetShardByChannelID(channelID)
+		byShard[pool] = append(byShard[pool], channelID)
+	}
+	return byShard
+}
+
+// pruneIndex drops index entries whose membership was not found. Such
+// entries are left behind by an interrupted removal or an add that failed
+// after indexing; recent ones are kept, as their membership may be about
+// to be added.
+func (r *Repository) pruneIndex(ctx context.Context, userID string, indexed map[string]indexEntry, found map[string]bool) {
+	for channelID, entry := range indexed {
+		if !found[channelID] && time.Since(entry.createdAt) > indexPruneGrace {
+			r.unindexMembership(ctx, userID, channelID)
+		}
+	}
+}
+
+// indexEntry is a user's channel index entry
+type indexEntry struct {
+	muted     bool
+	createdAt time.Time
+}
+
+// getIndexedChannels returns the entries in the user's channel index, keyed
+// by channel ID
+func (r *Repository) getIndexedChannels(ctx context.Context, userID string) (map[string]indexEntry, error) {
+	pool := r.db.GetShardByUserID(userID)
+
+	query := `SELECT channel_id, muted, created_at FROM user_channels WHERE user_id = $1`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channel index: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string]indexEntry)
+	for rows.Next() {
+		var channelID string
+		var entry indexEntry
+		if err := rows.Scan(&channelID, &entry.muted, &entry.createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan channel index entry: %w", err)
+		}
+		entries[channelID] = entry
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating channel index: %w", err)
+	}
+
+	return entries, nil
+}
+
+// indexRebuildBatchSize bounds how many memberships are indexed per insert
+// when rebuilding the index
+const indexRebuildBatchSize = 1000
+
+// RebuildUserChannelIndex indexes every membership on every shard, in
+// batches grouped by the shard of each member. Existing entries and their
+// settings are kept, so it is safe to run more than once.
+func (r *Repository) RebuildUserChannelIndex(ctx context.Context) error {
+	query := `
+		INSERT INTO user_channels (user_id, channel_id, muted, created_at)
+		SELECT membership.user_id, membership.channel_id, FALSE, NOW()
+		FROM UNNEST($1::uuid[], $2::uuid[]) AS membership (user_id, channel_id)
+		ON CONFLICT (user_id, channel_id) DO NOTHING
+	`
+
+	type batch struct{ userIDs, channelIDs []string }
+	flush := func(pool *pgxpool.Pool, b *batch) error {
+		if len(b.userIDs) == 0 {
+			return nil
+		}
+		if _, err := pool.Exec(ctx, query, b.userIDs, b.channelIDs); err != nil {
+			return fmt.Errorf("failed to index channel memberships: %w", err)
+		}
+		b.userIDs, b.channelIDs = b.userIDs[:0], b.channelIDs[:0]
+		return nil
+	}
+
+	for i, pool := range r.db.Shards() {
+		rows, err := pool.Query(ctx, `SELECT channel_id, user_id FROM channel_members`)
+		if err != nil {
+			return fmt.Errorf("failed to query memberships on shard %d: %w", i, err)
+		}
+
+		batches := make(map[*pgxpool.Pool]*batch)
+		for rows.Next() {
+			var channelID, userID string
+			if err := rows.Scan(&channelID, &userID); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan membership: %w", err)
+			}
+
+			target := r.db.GetShardByUserID(userID)
+			b, ok := batches[target]
+			if !ok {
+				b = &batch{}
+				batches[target] = b
+			}
+			b.userIDs = append(b.userIDs, userID)
+			b.channelIDs = append(b.channelIDs, channelID)
+			if len(b.userIDs) >= indexRebuildBatchSize {
+				if err := flush(target, b); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating memberships on shard %d: %w", i, err)
+		}
+
+		for target, b := range batches {
+			if err := flush(target, b); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// truncatePreview shortens content to maxPreviewLength characters
+func truncatePreview(content string) string {
+	if utf8.RuneCountInString(content) <= maxPreviewLength {
+		return content
+	}
+	runes := []rune(content)
+	return string(runes[:maxPreviewLength-1]) + "…"
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMyChannels returns the user's channels with their latest message,
+// unread count and mute state, most recently active first
+func (s *Service) ListMyChannels(ctx context.Context, userID string) ([]UserChannel, error) {
+	return s.repository.ListUserChannelsWithActivity(ctx, userID)
+}
+
+// UpdateChannelSettings changes the user's own settings for a channel
+func (s *Service) UpdateChannelSettings(ctx context.Context, channelID, userID string, req UpdateChannelSettingsRequest) error {
+	if _, err := s.policy.Authorize(ctx, channelID, userID, ActionReadMessages); err != nil {
+		return err
+	}
+	return s.repository.SetChannelMuted(ctx, userID, channelID, *req.Muted)
+}
+
+// Redis keys coordinating the one-off index backfill across instances
+const (
+	indexRebuildClaimKey = "chat:user_channels:rebuild:claim"
+	indexRebuildDoneKey  = "chat:user_channels:rebuild:done"
+)
+
+// indexRebuildClaimTTL releases the claim of an instance that died while
+// rebuilding, so another can take over
+const indexRebuildClaimTTL = time.Hour
+
+// RebuildUserChannelIndex backfills the per-user channel index from the
+// memberships on every shard. It runs once per deployment: the first
+// instance to claim it does the work and records that it is done, and later
+// calls return straight away.
+func (s *Service) RebuildUserChannelIndex(ctx context.Context) error {
+	done, err := s.redis.Exists(ctx, indexRebuildDoneKey)
+	if err != nil {
+		return fmt.Errorf("failed to check index rebuild: %w", err)
+	}
+	if done > 0 {
+		return nil
+	}
+
+	claimed, err := s.redis.SetNX(ctx, indexRebuildClaimKey, 1, indexRebuildClaimTTL)
+	if err != nil {
+		return fmt.Errorf("failed to claim index rebuild: %w", err)
+	}
+	if !claimed {
+		return nil
+	}
+	defer s.redis.Del(context.WithoutCancel(ctx), indexRebuildClaimKey)
+
+	if err := s.repository.RebuildUserChannelIndex(ctx); err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, indexRebuildDoneKey, 1, 0)
+}
+
+// listMyChannelsHandler handles the user's own channel list
+func (s *Service) listMyChannelsHandler(c *gin.Context) {
+	channels, err := s.ListMyChannels(c.Request.Context(), identity.UserID(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"channels": channels})
+}
+
+// updateChannelSettingsHandler handles changes to the user's channel settings
+func (s *Service) updateChannelSettingsHandler(c *gin.Context) {
+	var req UpdateChannelSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := s.UpdateChannelSettings(c.Request.Context(), c.Param("channel_id"), identity.UserID(c), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -16,31 +16,69 @@ type Config struct {
 	Chat             ChatConfig             `json:"chat" yaml:"chat"`
 	Presence         PresenceConfig         `json:"presence" yaml:"presence"`
 	Call             CallConfig             `json:"call" yaml:"call"`
+	Auth             AuthConfig             `json:"auth" yaml:"auth"`
 	Database         DatabaseConfig         `json:"database" yaml:"database"`
 	Redis            RedisConfig            `json:"redis" yaml:"redis"`
 	ServiceDiscovery ServiceDiscoveryConfig `json:"serviceDiscovery" yaml:"serviceDiscovery"`
+	Identity         IdentityConfig         `json:"identity" yaml:"identity"`
+	BlobStore        BlobStoreConfig        `json:"blobStore" yaml:"blobStore"`
 	Vault            VaultConfig            `json:"vault" yaml:"vault"`
 }
 
 // GatewayConfig holds API Gateway configuration
 type GatewayConfig struct {
-	Port         string        `json:"port" yaml:"port"`
-	JWTSecret    string        `json:"jwtSecret" yaml:"jwtSecret"`
-	RateLimit    int           `json:"rateLimit" yaml:"rateLimit"`
-	ReadTimeout  time.Duration `json:"readTimeout" yaml:"readTimeout"`
-	WriteTimeout time.Duration `json:"writeTimeout" yaml:"writeTimeout"`
+	Port         string          `json:"port" yaml:"port"`
+	JWTSecret    string          `json:"jwtSecret" yaml:"jwtSecret"`
+	JWKSFile     string          `json:"jwksFile" yaml:"jwksFile"`
+	RateLimit    int             `json:"rateLimit" yaml:"rateLimit"`
+	RateLimits   RateLimitConfig `json:"rateLimits" yaml:"rateLimits"`
+	ReadTimeout  time.Duration   `json:"readTimeout" yaml:"readTimeout"`
+	WriteTimeout time.Duration   `json:"writeTimeout" yaml:"writeTimeout"`
+}
+
+// RateLimitConfig holds per-route-class request limits. Each limit is the
+// number of requests allowed per user, or per IP for anonymous requests,
+// within the sliding window. GatewayConfig.RateLimit applies to other routes.
+type RateLimitConfig struct {
+	Window           time.Duration `json:"window" yaml:"window"`
+	MessageSend      int           `json:"messageSend" yaml:"messageSend"`
+	HistoryRead      int           `json:"historyRead" yaml:"historyRead"`
+	WebSocketConnect int           `json:"websocketConnect" yaml:"websocketConnect"`
 }
 
 // ChatConfig holds Chat service configuration
 type ChatConfig struct {
-	Port string `json:"port" yaml:"port"`
+	Port                   string           `json:"port" yaml:"port"`
+	TombstoneGracePeriod   time.Duration    `json:"tombstoneGracePeriod" yaml:"tombstoneGracePeriod"`
+	PurgeInterval          time.Duration    `json:"purgeInterval" yaml:"purgeInterval"`
+	MaxReactionsPerMessage int              `json:"maxReactionsPerMessage" yaml:"maxReactionsPerMessage"`
+	TypingTTL              time.Duration    `json:"typingTTL" yaml:"typingTTL"`
+	TypingThrottle         time.Duration    `json:"typingThrottle" yaml:"typingThrottle"`
+	Attachments            AttachmentConfig `json:"attachments" yaml:"attachments"`
+}
+
+// AttachmentConfig holds limits for uploaded message attachments and the
+// secret used to sign their download URLs
+type AttachmentConfig struct {
+	MaxSize      int64         `json:"maxSize" yaml:"maxSize"`
+	MaxChunkSize int64         `json:"maxChunkSize" yaml:"maxChunkSize"`
+	AllowedTypes []string      `json:"allowedTypes" yaml:"allowedTypes"`
+	UploadTTL    time.Duration `json:"uploadTTL" yaml:"uploadTTL"`
+	URLSecret    string        `json:"urlSecret" yaml:"urlSecret"`
+	URLTTL       time.Duration `json:"urlTTL" yaml:"urlTTL"`
+
+	// Image previews are generated by background workers
+	ThumbnailSizes []int `json:"thumbnailSizes" yaml:"thumbnailSizes"`
+	MaxImagePixels int64 `json:"maxImagePixels" yaml:"maxImagePixels"`
+	PreviewWorkers int   `json:"previewWorkers" yaml:"previewWorkers"`
 }
 
 // PresenceConfig holds Presence Service Configuration
 type PresenceConfig struct {
-	Port      string        `json:"port" yaml:"port"`
-	TTL       time.Duration `json:"ttl" yaml:"ttl"`
-	BatchSize int           `json:"batchSize" yaml:"batchSize"`
+	Port          string        `json:"port" yaml:"port"`
+	TTL           time.Duration `json:"ttl" yaml:"ttl"`
+	BatchSize     int           `json:"batchSize" yaml:"batchSize"`
+	SweepInterval time.Duration `json:"sweepInterval" yaml:"sweepInterval"`
 }
 
 // CallConfig holds call service configuration
@@ -48,6 +86,14 @@ type CallConfig struct {
 	Port string `json:"port" yaml:"port"`
 }
 
+// AuthConfig holds authentication service configuration
+type AuthConfig struct {
+	Port            string        `json:"port" yaml:"port"`
+	Issuer          string        `json:"issuer" yaml:"issuer"`
+	AccessTokenTTL  time.Duration `json:"accessTokenTTL" yaml:"accessTokenTTL"`
+	RefreshTokenTTL time.Duration `json:"refreshTokenTTL" yaml:"refreshTokenTTL"`
+}
+
 // DatabaseConfig holds PostgreSQL configuration
 type DatabaseConfig struct {
 	Host            string        `json:"host" yaml:"host"`
@@ -77,6 +123,27 @@ type ServiceDiscoveryConfig struct {
 	Interval time.Duration `json:"interval" yaml:"interval"`
 }
 
+// IdentityConfig holds configuration for the signed identity headers the
+// gateway attaches to requests it forwards to internal services
+type IdentityConfig struct {
+	HeaderSecret string        `json:"headerSecret" yaml:"headerSecret"`
+	MaxSkew      time.Duration `json:"maxSkew" yaml:"maxSkew"`
+}
+
+// BlobStoreConfig holds configuration for the store holding uploaded files.
+// Driver is "local" for a directory on disk or "s3" for any S3-compatible
+// object store; UsePathStyle is needed by most self-hosted stores.
+type BlobStoreConfig struct {
+	Driver          string `json:"driver" yaml:"driver"`
+	LocalPath       string `json:"localPath" yaml:"localPath"`
+	Endpoint        string `json:"endpoint" yaml:"endpoint"`
+	Region          string `json:"region" yaml:"region"`
+	Bucket          string `json:"bucket" yaml:"bucket"`
+	AccessKeyID     string `json:"accessKeyId" yaml:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey" yaml:"secretAccessKey"`
+	UsePathStyle    bool   `json:"usePathStyle" yaml:"usePathStyle"`
+}
+
 // VaultConfig holds secret vault configuration
 type VaultConfig struct {
 	Enabled    bool          `json:"enabled" yaml:"enabled"`
@@ -175,23 +242,56 @@ func getConfigSource() ConfigSource {
 func loadDefaults() (*Config, error) {
 	cfg := &Config{
 		Gateway: GatewayConfig{
-			Port:         ":8080",
-			JWTSecret:    "change-me-in-production",
-			RateLimit:    1000,
+			Port:      ":8080",
+			JWTSecret: "change-me-in-production",
+			RateLimit: 1000,
+			RateLimits: RateLimitConfig{
+				Window:           time.Duration(1) * time.Minute,
+				MessageSend:      60,
+				HistoryRead:      300,
+				WebSocketConnect: 10,
+			},
 			ReadTimeout:  15 * time.Second,
 			WriteTimeout: 15 * time.Second,
 		},
 		Chat: ChatConfig{
-			Port: ":8081",
+			Port:                   ":8081",
+			TombstoneGracePeriod:   time.Duration(24) * time.Hour,
+			PurgeInterval:          time.Duration(10) * time.Minute,
+			MaxReactionsPerMessage: 50,
+			TypingTTL:              time.Duration(6) * time.Second,
+			TypingThrottle:         time.Duration(3) * time.Second,
+			Attachments: AttachmentConfig{
+				MaxSize:      25 << 20,
+				MaxChunkSize: 5 << 20,
+				AllowedTypes: []string{
+					"image/jpeg", "image/png", "image/gif", "image/webp",
+					"video/mp4", "video/webm", "audio/mpeg", "audio/wave",
+					"application/ogg", "application/pdf", "application/zip", "text/plain",
+				},
+				UploadTTL:      time.Duration(24) * time.Hour,
+				URLSecret:      "change-me-in-production",
+				URLTTL:         time.Duration(5) * time.Minute,
+				ThumbnailSizes: []int{160, 480, 1024},
+				MaxImagePixels: 50_000_000,
+				PreviewWorkers: 2,
+			},
 		},
 		Presence: PresenceConfig{
-			Port:      ":8082",
-			TTL:       time.Duration(30) * time.Second,
-			BatchSize: 100,
+			Port:          ":8082",
+			TTL:           time.Duration(30) * time.Second,
+			BatchSize:     100,
+			SweepInterval: time.Duration(5) * time.Second,
 		},
 		Call: CallConfig{
 			Port: ":8083",
 		},
+		Auth: AuthConfig{
+			Port:            ":8084",
+			Issuer:          "chat-platform",
+			AccessTokenTTL:  time.Duration(15) * time.Minute,
+			RefreshTokenTTL: time.Duration(30*24) * time.Hour,
+		},
 		Database: DatabaseConfig{
 			Host:            "localhost",
 			Port:            "5432",
@@ -215,6 +315,15 @@ func loadDefaults() (*Config, error) {
 			Address:  "localhost:8500",
 			Interval: time.Duration(10) * time.Second,
 		},
+		Identity: IdentityConfig{
+			HeaderSecret: "change-me-in-production",
+			MaxSkew:      time.Duration(1) * time.Minute,
+		},
+		BlobStore: BlobStoreConfig{
+			Driver:    "local",
+			LocalPath: "/var/lib/chat-platform/blobs",
+			Region:    "us-east-1",
+		},
 		Vault: VaultConfig{
 			Enabled: false,
 		},
@@ -313,6 +422,24 @@ func loadFromKubernetes() (*Config, error) {
 		cfg.Gateway.JWTSecret = jwtSecret
 	}
 
+	// Identity header secrets
+	if identitySecret := readK8sSecret(secretsPath + "/identity/secret"); identitySecret != "" {
+		cfg.Identity.HeaderSecret = identitySecret
+	}
+
+	// Attachment URL signing and blob store secrets
+	if urlSecret := readK8sSecret(secretsPath + "/attachments/url-secret"); urlSecret != "" {
+		cfg.Chat.Attachments.URLSecret = urlSecret
+	}
+
+	if accessKey := readK8sSecret(secretsPath + "/blobstore/access-key-id"); accessKey != "" {
+		cfg.BlobStore.AccessKeyID = accessKey
+	}
+
+	if secretKey := readK8sSecret(secretsPath + "/blobstore/secret-access-key"); secretKey != "" {
+		cfg.BlobStore.SecretAccessKey = secretKey
+	}
+
 	// Load from ConfigMap environment variables (non-sensitive config)
 	if dbHost := os.Getenv("DATABASE_HOST"); dbHost != "" {
 		cfg.Database.Host = dbHost
@@ -326,6 +453,18 @@ func loadFromKubernetes() (*Config, error) {
 		cfg.Redis.Addresses = strings.Split(redisAddress, ",")
 	}
 
+	if blobDriver := os.Getenv("BLOBSTORE_DRIVER"); blobDriver != "" {
+		cfg.BlobStore.Driver = blobDriver
+	}
+
+	if blobEndpoint := os.Getenv("BLOBSTORE_ENDPOINT"); blobEndpoint != "" {
+		cfg.BlobStore.Endpoint = blobEndpoint
+	}
+
+	if blobBucket := os.Getenv("BLOBSTORE_BUCKET"); blobBucket != "" {
+		cfg.BlobStore.Bucket = blobBucket
+	}
+
 	return cfg, nil
 }
 
@@ -374,9 +513,18 @@ func loadFromHelm() (*Config, error) {
 	if jwtSecret := readK8sSecret(helmSecretsPath + "/jwt-secret"); jwtSecret != "" {
 		cfg.Gateway.JWTSecret = jwtSecret
 	}
+	if identitySecret := readK8sSecret(helmSecretsPath + "/identity-secret"); identitySecret != "" {
+		cfg.Identity.HeaderSecret = identitySecret
+	}
 	if redisPassword := readK8sSecret(helmSecretsPath + "/redis-password"); redisPassword != "" {
 		cfg.Redis.Password = redisPassword
 	}
+	if urlSecret := readK8sSecret(helmSecretsPath + "/attachment-url-secret"); urlSecret != "" {
+		cfg.Chat.Attachments.URLSecret = urlSecret
+	}
+	if secretKey := readK8sSecret(helmSecretsPath + "/blobstore-secret-access-key"); secretKey != "" {
+		cfg.BlobStore.SecretAccessKey = secretKey
+	}
 
 	return cfg, nil
 }
@@ -420,6 +568,113 @@ func (c *GatewayConfig) GetWriteTimeout() time.Duration {
 	return 15 * time.Second // default
 }
 
+// GetWindow returns the parsed rate limit window duration
+func (c *RateLimitConfig) GetWindow() time.Duration {
+	if c.Window > 0 {
+		return c.Window
+	}
+	return time.Minute // default
+}
+
+// GetTombstoneGracePeriod returns how long deleted message content is kept
+func (c *ChatConfig) GetTombstoneGracePeriod() time.Duration {
+	if c.TombstoneGracePeriod > 0 {
+		return c.TombstoneGracePeriod
+	}
+	return 24 * time.Hour // default
+}
+
+// GetPurgeInterval returns how often deleted message content is purged
+func (c *ChatConfig) GetPurgeInterval() time.Duration {
+	if c.PurgeInterval > 0 {
+		return c.PurgeInterval
+	}
+	return 10 * time.Minute // default
+}
+
+// GetMaxReactionsPerMessage returns how many distinct emoji a message may carry
+func (c *ChatConfig) GetMaxReactionsPerMessage() int {
+	if c.MaxReactionsPerMessage > 0 {
+		return c.MaxReactionsPerMessage
+	}
+	return 50 // default
+}
+
+// GetTypingTTL returns how long a typing indicator lasts without being renewed
+func (c *ChatConfig) GetTypingTTL() time.Duration {
+	if c.TypingTTL > 0 {
+		return c.TypingTTL
+	}
+	return 6 * time.Second // default
+}
+
+// GetTypingThrottle returns the shortest interval between relayed typing
+// signals from one user in one channel
+func (c *ChatConfig) GetTypingThrottle() time.Duration {
+	if c.TypingThrottle > 0 {
+		return c.TypingThrottle
+	}
+	return 3 * time.Second // default
+}
+
+// GetMaxSize returns the largest attachment accepted, in bytes
+func (c *AttachmentConfig) GetMaxSize() int64 {
+	if c.MaxSize > 0 {
+		return c.MaxSize
+	}
+	return 25 << 20 // default
+}
+
+// GetMaxChunkSize returns the largest upload chunk accepted, in bytes
+func (c *AttachmentConfig) GetMaxChunkSize() int64 {
+	if c.MaxChunkSize > 0 {
+		return c.MaxChunkSize
+	}
+	return 5 << 20 // default
+}
+
+// GetUploadTTL returns how long an unfinished upload may be resumed
+func (c *AttachmentConfig) GetUploadTTL() time.Duration {
+	if c.UploadTTL > 0 {
+		return c.UploadTTL
+	}
+	return 24 * time.Hour // default
+}
+
+// GetURLTTL returns how long a signed download URL stays valid
+func (c *AttachmentConfig) GetURLTTL() time.Duration {
+	if c.URLTTL > 0 {
+		return c.URLTTL
+	}
+	return 5 * time.Minute // default
+}
+
+// GetThumbnailSizes returns the bounding square sizes, in pixels, that image
+// thumbnails are generated for
+func (c *AttachmentConfig) GetThumbnailSizes() []int {
+	if len(c.ThumbnailSizes) > 0 {
+		return c.ThumbnailSizes
+	}
+	return []int{160, 480, 1024} // default
+}
+
+// GetMaxImagePixels returns the largest image, in pixels, previews are
+// generated for; decoding bigger ones would take too much memory
+func (c *AttachmentConfig) GetMaxImagePixels() int64 {
+	if c.MaxImagePixels > 0 {
+		return c.MaxImagePixels
+	}
+	return 50_000_000 // default
+}
+
+// GetPreviewWorkers returns how many image previews are generated at once
+func (c *AttachmentConfig) GetPreviewWorkers() int {
+	if c.PreviewWorkers > 0 {
+		return c.PreviewWorkers
+	}
+	return 2 // default
+}
+
 // GetTTL returns the parsed TTL duration
 func (c *PresenceConfig) GetTTL() time.Duration {
 	if c.TTL > 0 {
@@ -428,6 +683,48 @@ func (c *PresenceConfig) GetTTL() time.Duration {
 	return 30 * time.Second // default
 }
 
+// GetBatchSize returns how many users are read from Redis per round trip
+// when resolving presence in bulk
+func (c *PresenceConfig) GetBatchSize() int {
+	if c.BatchSize > 0 {
+		return c.BatchSize
+	}
+	return 100 // default
+}
+
+// GetSweepInterval returns how often expired presence is looked for so that
+// users going offline can be announced
+func (c *PresenceConfig) GetSweepInterval() time.Duration {
+	if c.SweepInterval > 0 {
+		return c.SweepInterval
+	}
+	return 5 * time.Second // default
+}
+
+// GetAccessTokenTTL returns the parsed access token lifetime
+func (c *AuthConfig) GetAccessTokenTTL() time.Duration {
+	if c.AccessTokenTTL > 0 {
+		return c.AccessTokenTTL
+	}
+	return 15 * time.Minute // default
+}
+
+// GetRefreshTokenTTL returns the parsed refresh token lifetime
+func (c *AuthConfig) GetRefreshTokenTTL() time.Duration {
+	if c.RefreshTokenTTL > 0 {
+		return c.RefreshTokenTTL
+	}
+	return 30 * 24 * time.Hour // default
+}
+
+// GetMaxSkew returns the parsed maximum age of a signed identity header
+func (c *IdentityConfig) GetMaxSkew() time.Duration {
+	if c.MaxSkew > 0 {
+		return c.MaxSkew
+	}
+	return time.Minute // default
+}
+
 // GetConnMaxLifetime returns the parsed connection max lifetime duration
 func (c *DatabaseConfig) GetConnMaxLifetime() time.Duration {
 	if c.ConnMaxLifetime > 0 {
@@ -450,6 +747,14 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("JWT secret must be changed in production")
 	}
 
+	if c.Identity.HeaderSecret == "change-me-in-production" {
+		return fmt.Errorf("identity header secret must be changed in production")
+	}
+
+	if c.Chat.Attachments.URLSecret == "change-me-in-production" {
+		return fmt.Errorf("attachment URL secret must be changed in production")
+	}
+
 	if c.Database.Password == "" {
 		return fmt.Errorf("database password is required")
 	}
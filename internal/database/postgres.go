@@ -81,6 +81,11 @@ func (db *PostgresDB) GetShardByUserID(userID string) *pgxpool.Pool {
 	return db.GetShard(ShardKey(userID))
 }
 
+// Shards returns every shard pool, for queries that must fan out across shards
+func (db *PostgresDB) Shards() []*pgxpool.Pool {
+	return db.pools
+}
+
 // Close closes all the database connections
 func (db *PostgresDB) Close() {
 	for _, pool := range db.pools {
@@ -147,7 +152,108 @@ func (db *PostgresDB) createTables(ctx context.Context, pool *pgxpool.Pool) erro
 			message_type VARCHAR(50) NOT NULL DEFAULT 'text',
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
 			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			idempotency_key VARCHAR(255) UNIQUE
+			idempotency_key VARCHAR(255) UNIQUE,
+			deleted_at TIMESTAMP WITH TIME ZONE,
+			deleted_by UUID REFERENCES users(id),
+			parent_id UUID REFERENCES messages(id),
+			reply_count INTEGER NOT NULL DEFAULT 0,
+			last_reply_at TIMESTAMP WITH TIME ZONE,
+			also_sent_to_channel BOOLEAN NOT NULL DEFAULT FALSE
+		);`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_by UUID REFERENCES users(id);`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES messages(id);`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_count INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS last_reply_at TIMESTAMP WITH TIME ZONE;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS also_sent_to_channel BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS content_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;`,
+
+		`CREATE TABLE IF NOT EXISTS message_revisions (
+			message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			revision INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			edited_by UUID NOT NULL REFERENCES users(id),
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			replaced_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (message_id, revision)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS message_reactions (
+			message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			emoji VARCHAR(64) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (message_id, user_id, emoji)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS channel_read_states (
+			channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			last_read_message_id UUID NOT NULL,
+			last_read_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (channel_id, user_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS user_channels (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			channel_id UUID NOT NULL,
+			muted BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (user_id, channel_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS message_mentions (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			message_id UUID NOT NULL,
+			channel_id UUID NOT NULL,
+			mentioned_by UUID NOT NULL,
+			kind VARCHAR(16) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			PRIMARY KEY (user_id, message_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS attachment_uploads (
+			id UUID PRIMARY KEY,
+			channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id),
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL DEFAULT '',
+			size BIGINT NOT NULL,
+			received BIGINT NOT NULL DEFAULT 0,
+			parts INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS message_attachments (
+			id UUID PRIMARY KEY,
+			channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+			message_id UUID REFERENCES messages(id) ON DELETE CASCADE,
+			uploaded_by UUID NOT NULL REFERENCES users(id),
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			size BIGINT NOT NULL,
+			storage_key TEXT NOT NULL,
+			width INTEGER,
+			height INTEGER,
+			blurhash VARCHAR(64),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);`,
+		`ALTER TABLE message_attachments ADD COLUMN IF NOT EXISTS width INTEGER;`,
+		`ALTER TABLE message_attachments ADD COLUMN IF NOT EXISTS height INTEGER;`,
+		`ALTER TABLE message_attachments ADD COLUMN IF NOT EXISTS blurhash VARCHAR(64);`,
+
+		`CREATE TABLE IF NOT EXISTS attachment_thumbnails (
+			attachment_id UUID NOT NULL REFERENCES message_attachments(id) ON DELETE CASCADE,
+			max_edge INTEGER NOT NULL,
+			width INTEGER NOT NULL,
+			height INTEGER NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			size BIGINT NOT NULL,
+			storage_key TEXT NOT NULL,
+			PRIMARY KEY (attachment_id, max_edge)
 		);`,
 
 		`CREATE TABLE IF NOT EXISTS call_sessions (
@@ -155,7 +261,7 @@ func (db *PostgresDB) createTables(ctx context.Context, pool *pgxpool.Pool) erro
 			channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
 			created_by UUID NOT NULL REFERENCES users(id),
 			status VARCHAR(50) NOT NULL DEFAULT 'active',
-			call_type VARHCAR(50) NOT NULL DEFAULT 'audio',
+			call_type VARCHAR(50) NOT NULL DEFAULT 'audio',
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
 			ended_at TIMESTAMP WITH TIME ZONE
 		);`,
@@ -168,12 +274,31 @@ func (db *PostgresDB) createTables(ctx context.Context, pool *pgxpool.Pool) erro
 			signalling_state VARCHAR(50) DEFAULT 'joining',
 			PRIMARY KEY (call_id, user_id)
 		);`,
+		// Databases created from older schema scripts spelled the column
+		// signaling_state
+		`DO $$
+		BEGIN
+			IF EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_name = 'call_participants' AND column_name = 'signaling_state'
+			) THEN
+				ALTER TABLE call_participants RENAME COLUMN signaling_state TO signalling_state;
+			END IF;
+		END $$;`,
 
 		// Indexes for performance
 		`CREATE INDEX IF NOT EXISTS idx_messages_channel_created ON messages(channel_id, created_at DESC);`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_idempotency ON  messages(idempotency_key) WHERE idempotency_key IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_parent_created ON messages(parent_id, created_at) WHERE parent_id IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_message_reactions_message ON message_reactions(message_id, emoji);`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_content_tsv ON messages USING GIN (content_tsv);`,
+		`CREATE INDEX IF NOT EXISTS idx_message_mentions_user_created ON message_mentions(user_id, created_at DESC);`,
+		`CREATE INDEX IF NOT EXISTS idx_message_attachments_message ON message_attachments(message_id) WHERE message_id IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_attachment_uploads_expires ON attachment_uploads(expires_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_deleted ON messages(deleted_at) WHERE deleted_at IS NOT NULL;`,
 		`CREATE INDEX IF NOT EXISTS idx_channel_members_user ON channel_members(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_call_sessions_channel ON call_sessions(channel_id);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_call_sessions_active_channel ON call_sessions(channel_id) WHERE status = 'active';`,
 		`CREATE INDEX IF NOT EXISTS idx_call_participants_user ON call_participants(user_id);`,
 	}
 
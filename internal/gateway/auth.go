@@ -0,0 +1,189 @@
+package gateway
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"real-time-chat-system/internal/config"
+	"real-time-chat-system/internal/identity"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// tokenVerifier verifies access tokens signed with the shared HS256 secret
+// or with an RS256 key from the configured JWKS file
+type tokenVerifier struct {
+	secret  []byte
+	rsaKeys map[string]*rsa.PublicKey
+}
+
+// jwks is the JSON Web Key Set file format
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// newTokenVerifier creates a verifier from the gateway configuration
+func newTokenVerifier(cfg *config.GatewayConfig) (*tokenVerifier, error) {
+	verifier := &tokenVerifier{
+		secret:  []byte(cfg.JWTSecret),
+		rsaKeys: make(map[string]*rsa.PublicKey),
+	}
+
+	if cfg.JWKSFile == "" {
+		return verifier, nil
+	}
+
+	data, err := os.ReadFile(cfg.JWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var keySet jwks
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	for _, key := range keySet.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %q: %w", key.Kid, err)
+		}
+
+		verifier.rsaKeys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return verifier, nil
+}
+
+// verify parses and validates an access token and returns its claims
+func (v *tokenVerifier) verify(tokenString string) (*identity.Claims, error) {
+	claims := &identity.Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, v.keyFunc,
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", jwt.ErrTokenInvalidClaims)
+	}
+	if claims.TokenType != "" && claims.TokenType != identity.TokenTypeAccess {
+		return nil, fmt.Errorf("%w: not an access token", jwt.ErrTokenInvalidClaims)
+	}
+
+	return claims, nil
+}
+
+// keyFunc selects the verification key for a token
+func (v *tokenVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(v.secret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return v.secret, nil
+	case *jwt.SigningMethodRSA:
+		kid, _ := token.Header["kid"].(string)
+		if key, exists := v.rsaKeys[kid]; exists {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	default:
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+}
+
+// bearerToken extracts the access token from the request. Browsers cannot set
+// headers on WebSocket handshakes, so those may pass it as a query parameter.
+func bearerToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		return c.Query("access_token")
+	}
+
+	return ""
+}
+
+// authMiddleware provides JWT authentication and forwards the caller's
+// identity to upstream services in signed headers
+func (g *Gateway) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Never trust identity headers supplied by the client
+		identity.Strip(c.Request.Header)
+
+		tokenString := bearerToken(c)
+		if tokenString == "" {
+			abortUnauthorized(c, "TOKEN_MISSING", "Missing bearer token")
+			return
+		}
+
+		claims, err := g.tokenVerifier.verify(tokenString)
+		if err != nil {
+			switch {
+			case errors.Is(err, jwt.ErrTokenExpired):
+				abortUnauthorized(c, "TOKEN_EXPIRED", "Token has expired")
+			case errors.Is(err, jwt.ErrTokenNotValidYet):
+				abortUnauthorized(c, "TOKEN_NOT_YET_VALID", "Token is not valid yet")
+			case errors.Is(err, jwt.ErrTokenMalformed):
+				abortUnauthorized(c, "TOKEN_MALFORMED", "Token is malformed")
+			case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+				abortUnauthorized(c, "TOKEN_SIGNATURE_INVALID", "Token signature is invalid")
+			default:
+				abortUnauthorized(c, "TOKEN_INVALID", "Token is invalid")
+			}
+			return
+		}
+
+		identity.SetUserID(c, claims.Subject)
+		g.signer.Sign(c.Request.Header, claims.Subject)
+
+		c.Next()
+	}
+}
+
+// abortUnauthorized rejects the request with a structured 401 response
+func abortUnauthorized(c *gin.Context, code, message string) {
+	if code == "TOKEN_MISSING" {
+		c.Header("WWW-Authenticate", "Bearer")
+	} else {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error": message,
+		"code":  code,
+	})
+}
@@ -1,14 +1,19 @@
 package gateway
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"real-time-chat-system/internal/chat"
 	"real-time-chat-system/internal/config"
 	"real-time-chat-system/internal/database"
 	"real-time-chat-system/internal/discovery"
 	"real-time-chat-system/internal/health"
+	"real-time-chat-system/internal/identity"
 	redisclient "real-time-chat-system/internal/redis"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
 // Gateway represents the API Gateway service
@@ -19,12 +24,23 @@ type Gateway struct {
 	loadBalancer     *discovery.LoadBalancer
 	db               *database.PostgresDB
 	redis            *redisclient.Client
+	transport        *http.Transport
+	hub              *Hub
+	chatRepository   *chat.Repository
+	upgrader         websocket.Upgrader
+	tokenVerifier    *tokenVerifier
+	signer           *identity.Signer
 }
 
 // New creates a new API Gateway instance
-func New(cfg *config.GatewayConfig, serviceDiscovery discovery.Discovery, healthChecker *health.Checker, db *database.PostgresDB, redisClient *redisclient.Client) (*Gateway, error) {
+func New(cfg *config.GatewayConfig, chatCfg *config.ChatConfig, presenceCfg *config.PresenceConfig, serviceDiscovery discovery.Discovery, healthChecker *health.Checker, db *database.PostgresDB, redisClient *redisclient.Client, signer *identity.Signer) (*Gateway, error) {
 	loadBalancer := discovery.NewLoadBalancer(serviceDiscovery)
 
+	verifier, err := newTokenVerifier(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize token verifier: %w", err)
+	}
+
 	gateway := &Gateway{
 		config:           cfg,
 		serviceDiscovery: serviceDiscovery,
@@ -32,6 +48,18 @@ func New(cfg *config.GatewayConfig, serviceDiscovery discovery.Discovery, health
 		loadBalancer:     loadBalancer,
 		db:               db,
 		redis:            redisClient,
+		transport:        newProxyTransport(cfg.GetReadTimeout()),
+		hub:              NewHub(redisClient, chat.NewTypingRelay(redisClient, chatCfg), presenceCfg.GetTTL()),
+		chatRepository:   chat.NewRepository(db),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Clients connect from native apps and other origins; the origin
+			// plays no part in authenticating the connection
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		tokenVerifier: verifier,
+		signer:        signer,
 	}
 
 	// Add health checks
@@ -39,9 +67,18 @@ func New(cfg *config.GatewayConfig, serviceDiscovery discovery.Discovery, health
 	healthChecker.AddCheck("database", health.DatabaseHealthCheck(db))
 	healthChecker.AddCheck("redis", health.RedisHealthCheck(redisClient))
 
+	go gateway.hub.Run()
+	go gateway.hub.RunMembership()
+	go gateway.hub.RunPresenceRefresher()
+
 	return gateway, nil
 }
 
+// Close releases the gateway's background resources
+func (g *Gateway) Close() {
+	g.hub.Close()
+}
+
 // Router returns the HTTP router for the gateway
 func (g *Gateway) Router() http.Handler {
 	// Set Gin mode based on environment
@@ -62,73 +99,144 @@ func (g *Gateway) Router() http.Handler {
 	// API routes
 	v1 := router.Group("/v1")
 	{
-		// Authentication middleware would be added here
-		v1.Use(g.authMiddleware())
+		// Authentication endpoints are public
+		authRoutes := v1.Group("/auth", g.rateLimitMiddleware(rateLimitDefault))
+		{
+			authRoutes.POST("/register", g.proxyToService("auth-service", "/v1/auth/register"))
+			authRoutes.POST("/login", g.proxyToService("auth-service", "/v1/auth/login"))
+			authRoutes.POST("/refresh", g.proxyToService("auth-service", "/v1/auth/refresh"))
+			authRoutes.POST("/logout", g.proxyToService("auth-service", "/v1/auth/logout"))
+		}
+
+		// Attachment downloads are authorized by the signed URL itself, so
+		// they work from plain <img> and <a> tags
+		v1.GET("/attachments/:id/content", g.rateLimitMiddleware(rateLimitDefault), g.proxyToService("chat-service", "/v1/attachments/:attachment_id/content"))
+
+		// All other endpoints require a valid access token
+		api := v1.Group("", g.authMiddleware())
+
+		// Each request is charged to exactly one bucket: routes in a route
+		// class use that class's limiter, everything else the default one
+		sends := api.Group("", g.rateLimitMiddleware(rateLimitMessageSend))
+		{
+			sends.POST("/channels/:id/messages", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages"))
+			sends.PATCH("/channels/:id/messages/:message_id", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages/:message_id"))
+		}
+
+		reads := api.Group("", g.rateLimitMiddleware(rateLimitHistoryRead))
+		{
+			reads.GET("/channels/:id/messages", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages"))
+			reads.GET("/channels/:id/messages/:message_id/revisions", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages/:message_id/revisions"))
+			reads.GET("/channels/:id/messages/:message_id/thread", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages/:message_id/thread"))
+			reads.GET("/me/mentions", g.proxyToService("chat-service", "/v1/me/mentions"))
+			reads.GET("/search/messages", g.proxyToService("chat-service", "/v1/search/messages"))
+		}
+
+		// WebSocket endpoint
+		api.GET("/ws", g.rateLimitMiddleware(rateLimitWebSocket), g.handleWebSocket)
+
+		standard := api.Group("", g.rateLimitMiddleware(rateLimitDefault))
 
 		// Chat endpoints
-		channels := v1.Group("/channels")
+		channels := standard.Group("/channels")
 		{
-			channels.POST("/:id/messages", g.proxyToService("chat-service"))
-			channels.GET("/:id/messages", g.proxyToService("chat-service"))
+			channels.POST("", g.proxyToService("chat-service", "/v1/channels"))
+			channels.GET("", g.proxyToService("chat-service", "/v1/channels"))
+			channels.GET("/:id", g.proxyToService("chat-service", "/v1/channels/:channel_id"))
+			channels.PATCH("/:id", g.proxyToService("chat-service", "/v1/channels/:channel_id"))
+			channels.DELETE("/:id", g.proxyToService("chat-service", "/v1/channels/:channel_id"))
+			channels.POST("/:id/join", g.proxyToService("chat-service", "/v1/channels/:channel_id/join"))
+			channels.POST("/:id/leave", g.proxyToService("chat-service", "/v1/channels/:channel_id/leave"))
+			channels.GET("/:id/members", g.proxyToService("chat-service", "/v1/channels/:channel_id/members"))
+			channels.GET("/:id/online", g.proxyToService("chat-service", "/v1/channels/:channel_id/online"))
+			channels.POST("/:id/members", g.proxyToService("chat-service", "/v1/channels/:channel_id/members"))
+			channels.PATCH("/:id/members/:user_id", g.proxyToService("chat-service", "/v1/channels/:channel_id/members/:user_id"))
+			channels.DELETE("/:id/members/:user_id", g.proxyToService("chat-service", "/v1/channels/:channel_id/members/:user_id"))
+
+			channels.DELETE("/:id/messages/:message_id", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages/:message_id"))
+			channels.POST("/:id/messages/:message_id/read", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages/:message_id/read"))
+			channels.POST("/:id/messages/:message_id/reactions", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages/:message_id/reactions"))
+			channels.DELETE("/:id/messages/:message_id/reactions/:emoji", g.proxyToService("chat-service", "/v1/channels/:channel_id/messages/:message_id/reactions/:emoji"))
+
+			channels.POST("/:id/typing", g.proxyToService("chat-service", "/v1/channels/:channel_id/typing"))
+
+			channels.POST("/:id/uploads", g.proxyToService("chat-service", "/v1/channels/:channel_id/uploads"))
+			channels.GET("/:id/uploads/:upload_id", g.proxyToService("chat-service", "/v1/channels/:channel_id/uploads/:upload_id"))
+			channels.PUT("/:id/uploads/:upload_id", g.proxyToService("chat-service", "/v1/channels/:channel_id/uploads/:upload_id"))
+			channels.GET("/:id/attachments/:attachment_id", g.proxyToService("chat-service", "/v1/channels/:channel_id/attachments/:attachment_id"))
+		}
+
+		// Endpoints scoped to the calling user
+		me := standard.Group("/me")
+		{
+			me.GET("/unread", g.proxyToService("chat-service", "/v1/me/unread"))
+			me.GET("/channels", g.proxyToService("chat-service", "/v1/me/channels"))
+			me.PATCH("/channels/:id", g.proxyToService("chat-service", "/v1/me/channels/:channel_id"))
 		}
 
 		// Call endpoints
-		calls := v1.Group("/calls")
+		calls := standard.Group("/calls")
 		{
-			calls.POST("", g.proxyToService("call-service"))
-			calls.POST("/:id/join", g.proxyToService("call-service"))
+			calls.POST("", g.proxyToService("call-service", "/v1/calls"))
+			calls.GET("/:id", g.proxyToService("call-service", "/v1/calls/:id"))
+			calls.POST("/:id/join", g.proxyToService("call-service", "/v1/calls/:id/join"))
+			calls.POST("/:id/leave", g.proxyToService("call-service", "/v1/calls/:id/leave"))
+			calls.POST("/:id/end", g.proxyToService("call-service", "/v1/calls/:id/end"))
 		}
 
 		// Presence endpoints
-		presence := v1.Group("/presence")
+		presence := standard.Group("/presence")
 		{
-			presence.POST("/heartbeat", g.proxyToService("presence-service"))
+			presence.POST("/heartbeat", g.proxyToService("presence-service", "/v1/heartbeat"))
+			presence.GET("/:user_id", g.proxyToService("presence-service", "/v1/presence/:userID"))
+			presence.POST("/query", g.proxyToService("presence-service", "/v1/presence/query"))
+			presence.PUT("/status", g.proxyToService("presence-service", "/v1/status"))
+			presence.DELETE("/status", g.proxyToService("presence-service", "/v1/status"))
 		}
-
-		// WebSocket endpoint
-		v1.GET("/ws", g.handleWebSocket)
 	}
 
 	return router
 }
 
-// authMiddleware provides JWT authentication
-func (g *Gateway) authMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// For now, just pass through
-		// In a real implementation, this would validate JWT tokens
-		c.Next()
+// handleWebSocket upgrades the connection and subscribes it to the user's
+// own events and the events of every channel the user belongs to
+func (g *Gateway) handleWebSocket(c *gin.Context) {
+	userID := identity.UserID(c)
+
+	channelIDs, err := g.chatRepository.GetUserChannelIDs(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load channel memberships",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
 	}
-}
 
-// proxyToService creates a handler that proxies requests to a service
-func (g *Gateway) proxyToService(serviceName string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		instance, err := g.loadBalancer.GetInstance(serviceName)
-		if err != nil {
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "Service unavailable",
-				"code":  "SERVICE_UNAVAILABLE",
-			})
-			return
-		}
+	conn, err := g.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		return
+	}
 
-		// For now, return a placeholder response
-		// In a real implementation, this would proxy the request
-		c.JSON(http.StatusOK, gin.H{
-			"message":  "Request would be proxied to " + serviceName,
-			"instance": instance.Address + ":" + instance.Port,
-		})
+	client := newWSClient(g.hub, conn, userID)
+
+	// The user's own topic carries membership changes so the connection can
+	// follow channels it joins or leaves after connecting
+	topics := make([]string, 0, len(channelIDs)+1)
+	topics = append(topics, chat.UserEventsTopic(userID))
+	for _, channelID := range channelIDs {
+		topics = append(topics, chat.ChannelEventsTopic(channelID))
 	}
-}
+	if err := g.hub.register(client, topics); err != nil {
+		log.Printf("Failed to subscribe WebSocket for user %s: %v", userID, err)
+		g.hub.unregister(client)
+		conn.Close()
+		return
+	}
+	g.hub.markPresent(client, channelIDs)
 
-// handleWebSocket handles WebSocket connections
-func (g *Gateway) handleWebSocket(c *gin.Context) {
-	// For now, return a placeholder response
-	// In a real implementation, this would upgrade to WebSocket
-	c.JSON(http.StatusOK, gin.H{
-		"message": "WebSocket endpoint - would upgrade connection",
-	})
+	go client.writePump()
+	go client.readPump()
 }
 
 // metricsHandler exposes Prometheus metrics
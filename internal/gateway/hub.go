@@ -0,0 +1,689 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"real-time-chat-system/internal/chat"
+	"real-time-chat-system/internal/presence"
+	redisclient "real-time-chat-system/internal/redis"
+
+	"github.com/gorilla/websocket"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// Time allowed to write a message to the peer
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer
+	pongWait = 60 * time.Second
+
+	// Send pings to peer with this period, must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+
+	// Maximum message size allowed from peer
+	maxMessageSize = 4096
+
+	// Outbound events buffered per connection before it is evicted as a slow consumer
+	sendBufferSize = 256
+
+	// Membership changes buffered before dispatch waits for them to be applied
+	membershipQueueSize = 1024
+)
+
+// Hub tracks the WebSocket connections on this gateway node and fans out
+// Redis pub/sub events to the connections subscribed to each topic
+type Hub struct {
+	redis       *redisclient.Client
+	typing      *chat.TypingRelay
+	presenceTTL time.Duration
+	pubsub      *goredis.PubSub
+	topics      map[string]map[*wsClient]struct{}
+	mutex       sync.RWMutex
+	// subscribing serializes subscription changes so that pub/sub commands
+	// can run without holding mutex, which dispatch needs for every event
+	subscribing sync.Mutex
+	membership  chan membershipChange
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+// NewHub creates a new connection hub
+func NewHub(redisClient *redisclient.Client, typing *chat.TypingRelay, presenceTTL time.Duration) *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Hub{
+		redis:       redisClient,
+		typing:      typing,
+		presenceTTL: presenceTTL,
+		pubsub:      redisClient.Subscribe(ctx),
+		topics:      make(map[string]map[*wsClient]struct{}),
+		membership:  make(chan membershipChange, membershipQueueSize),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Run dispatches Redis events to local connections until the hub is closed
+func (h *Hub) Run() {
+	events := h.pubsub.Channel(goredis.WithChannelSize(1000))
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case msg, ok := <-events:
+			if !ok {
+				return
+			}
+			h.dispatch(msg.Channel, []byte(msg.Payload))
+		}
+	}
+}
+
+// RunMembership applies the membership changes queued by dispatch until the
+// hub is closed. The Redis round trips they need run here rather than in
+// Run, so a slow Redis does not hold up fan-out; a single worker keeps the
+// changes in order.
+func (h *Hub) RunMembership() {
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case change := <-h.membership:
+			h.followMembership(change)
+		}
+	}
+}
+
+// RunPresenceRefresher keeps every connected user present in the channels
+// their connections follow, refreshing them several times per presence TTL
+// until the hub is closed. Users whose connections are gone stop being
+// refreshed and are swept by the presence service.
+func (h *Hub) RunPresenceRefresher() {
+	ticker := time.NewTicker(h.presenceTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			h.refreshPresence()
+		}
+	}
+}
+
+// refreshPresence refreshes the channel presence of the users connected to
+// this node. Users who have gone invisible are removed instead, so they
+// are not listed as online while still connected.
+func (h *Hub) refreshPresence() {
+	members := h.channelMembers()
+
+	userIDs := make([]string, 0, len(members))
+	seen := make(map[string]struct{})
+	for _, channelMembers := range members {
+		for _, userID := range channelMembers {
+			if _, ok := seen[userID]; !ok {
+				seen[userID] = struct{}{}
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+
+	invisible, err := h.invisibleUsers(userIDs)
+	if err != nil {
+		log.Printf("Failed to load presence for channel refresh: %v", err)
+		return
+	}
+
+	for channelID, channelMembers := range members {
+		visible := channelMembers[:0]
+		for _, userID := range channelMembers {
+			if !invisible[userID] {
+				visible = append(visible, userID)
+				continue
+			}
+			if err := h.redis.RemoveFromChannelPresence(h.ctx, channelID, userID); err != nil {
+				log.Printf("Failed to remove user %s from channel presence: %v", userID, err)
+			}
+		}
+
+		if len(visible) == 0 {
+			delete(members, channelID)
+		} else {
+			members[channelID] = visible
+		}
+	}
+
+	if err := h.redis.RefreshChannelPresence(h.ctx, members); err != nil {
+		log.Printf("Failed to refresh channel presence: %v", err)
+	}
+}
+
+// invisibleUsers returns which of the given users are invisible to others
+// now
+func (h *Hub) invisibleUsers(userIDs []string) (map[string]bool, error) {
+	invisible := make(map[string]bool)
+	if len(userIDs) == 0 {
+		return invisible, nil
+	}
+
+	entries, err := h.redis.GetPresenceBatch(h.ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i, entry := range entries {
+		if presence.Invisible(entry.Devices, now) {
+			invisible[userIDs[i]] = true
+		}
+	}
+	return invisible, nil
+}
+
+// channelMembers returns the users connected to this node, keyed by the
+// channels their connections follow
+func (h *Hub) channelMembers() map[string][]string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	members := make(map[string][]string)
+	for topic, subscribers := range h.topics {
+		channelID, ok := chat.ChannelIDFromTopic(topic)
+		if !ok {
+			continue
+		}
+
+		seen := make(map[string]struct{}, len(subscribers))
+		for client := range subscribers {
+			if _, ok := seen[client.userID]; ok {
+				continue
+			}
+			seen[client.userID] = struct{}{}
+			members[channelID] = append(members[channelID], client.userID)
+		}
+	}
+	return members
+}
+
+// markPresent makes a client's user present in channels straight away
+// rather than at the next refresh, unless the user is invisible
+func (h *Hub) markPresent(client *wsClient, channelIDs []string) {
+	if len(channelIDs) == 0 {
+		return
+	}
+
+	invisible, err := h.invisibleUsers([]string{client.userID})
+	if err != nil {
+		log.Printf("Failed to load presence of user %s: %v", client.userID, err)
+		return
+	}
+	if invisible[client.userID] {
+		return
+	}
+
+	members := make(map[string][]string, len(channelIDs))
+	for _, channelID := range channelIDs {
+		members[channelID] = []string{client.userID}
+	}
+	if err := h.redis.RefreshChannelPresence(h.ctx, members); err != nil {
+		log.Printf("Failed to mark user %s present: %v", client.userID, err)
+	}
+}
+
+// Close disconnects all clients and stops the hub
+func (h *Hub) Close() {
+	h.cancel()
+
+	h.mutex.Lock()
+	clients := make(map[*wsClient]struct{})
+	for _, subscribers := range h.topics {
+		for client := range subscribers {
+			clients[client] = struct{}{}
+		}
+	}
+	h.topics = make(map[string]map[*wsClient]struct{})
+	h.mutex.Unlock()
+
+	for client := range clients {
+		client.close()
+	}
+	h.pubsub.Close()
+}
+
+// register attaches a client to the given topics, subscribing this node to
+// any topic that has no local subscribers yet. Topics are only recorded
+// once the subscription has succeeded, so after a failure the next client
+// to ask for a topic tries again.
+func (h *Hub) register(client *wsClient, topics []string) error {
+	h.subscribing.Lock()
+	defer h.subscribing.Unlock()
+
+	h.mutex.RLock()
+	// A client that has already gone away must not be re-attached by a late
+	// membership event
+	if client.unregistered {
+		h.mutex.RUnlock()
+		return nil
+	}
+	var newTopics []string
+	for _, topic := range topics {
+		if _, exists := h.topics[topic]; !exists {
+			newTopics = append(newTopics, topic)
+		}
+	}
+	h.mutex.RUnlock()
+
+	if len(newTopics) > 0 {
+		if err := h.pubsub.Subscribe(h.ctx, newTopics...); err != nil {
+			return err
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, topic := range topics {
+		subscribers, exists := h.topics[topic]
+		if !exists {
+			subscribers = make(map[*wsClient]struct{})
+			h.topics[topic] = subscribers
+		}
+		subscribers[client] = struct{}{}
+		client.topics[topic] = struct{}{}
+	}
+	return nil
+}
+
+// unregister detaches a client from all of its topics, unsubscribing this
+// node from topics that no longer have local subscribers
+func (h *Hub) unregister(client *wsClient) {
+	h.subscribing.Lock()
+	defer h.subscribing.Unlock()
+
+	h.mutex.Lock()
+	client.unregistered = true
+	topics := make([]string, 0, len(client.topics))
+	for topic := range client.topics {
+		topics = append(topics, topic)
+	}
+	staleTopics := h.removeLocked(client, topics)
+	h.mutex.Unlock()
+
+	h.unsubscribe(staleTopics)
+}
+
+// detach removes a client from the given topics while leaving the rest of
+// its subscriptions in place
+func (h *Hub) detach(client *wsClient, topics []string) {
+	h.subscribing.Lock()
+	defer h.subscribing.Unlock()
+
+	h.mutex.Lock()
+	staleTopics := h.removeLocked(client, topics)
+	h.mutex.Unlock()
+
+	h.unsubscribe(staleTopics)
+}
+
+// removeLocked removes a client from topics and returns those left without
+// local subscribers. The caller holds the mutex.
+func (h *Hub) removeLocked(client *wsClient, topics []string) []string {
+	var staleTopics []string
+	for _, topic := range topics {
+		if _, ok := client.topics[topic]; !ok {
+			continue
+		}
+		delete(client.topics, topic)
+
+		subscribers := h.topics[topic]
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(h.topics, topic)
+			staleTopics = append(staleTopics, topic)
+		}
+	}
+	return staleTopics
+}
+
+// unsubscribe unsubscribes this node from topics left without local
+// subscribers. The caller holds subscribing but not the mutex.
+func (h *Hub) unsubscribe(topics []string) {
+	if len(topics) == 0 || h.ctx.Err() != nil {
+		return
+	}
+	if err := h.pubsub.Unsubscribe(h.ctx, topics...); err != nil {
+		log.Printf("Failed to unsubscribe from topics: %v", err)
+	}
+}
+
+// subscribed reports whether a client currently receives a topic's events
+func (h *Hub) subscribed(client *wsClient, topic string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	_, ok := client.topics[topic]
+	return ok
+}
+
+// countTopics returns how many of a client's topics start with prefix
+func (h *Hub) countTopics(client *wsClient, prefix string) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	count := 0
+	for topic := range client.topics {
+		if strings.HasPrefix(topic, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// dispatch delivers a payload to every local subscriber of a topic
+func (h *Hub) dispatch(topic string, payload []byte) {
+	h.mutex.RLock()
+	var delivered, slow []*wsClient
+	for client := range h.topics[topic] {
+		select {
+		case client.send <- payload:
+			delivered = append(delivered, client)
+		default:
+			slow = append(slow, client)
+		}
+	}
+	h.mutex.RUnlock()
+
+	// Evict clients that cannot keep up rather than blocking everyone else
+	for _, client := range slow {
+		log.Printf("Evicting slow WebSocket consumer for user %s", client.userID)
+		h.unregister(client)
+		client.close()
+	}
+
+	h.queueMembership(topic, payload, delivered)
+}
+
+// membershipEnvelope is the part of an event the hub inspects to keep
+// connection subscriptions in step with channel membership
+type membershipEnvelope struct {
+	Type      string  `json:"type"`
+	ChannelID *string `json:"channel_id"`
+}
+
+// membershipMarkers are the encoded type fields of the events that change
+// channel membership. Events are marshalled compactly, so a payload without
+// any of them needs no decoding.
+var membershipMarkers = [][]byte{
+	[]byte(`"type":"` + chat.EventChannelJoined + `"`),
+	[]byte(`"type":"` + chat.EventChannelLeft + `"`),
+	[]byte(`"type":"` + chat.EventChannelDeleted + `"`),
+}
+
+// membershipChange is a membership event waiting to be applied to the
+// clients it was delivered to
+type membershipChange struct {
+	topic     string
+	eventType string
+	channelID string
+	clients   []*wsClient
+}
+
+// queueMembership hands a membership event delivered to clients over to
+// RunMembership. Other events are skipped without being decoded.
+func (h *Hub) queueMembership(topic string, payload []byte, clients []*wsClient) {
+	if len(clients) == 0 || !hasMembershipMarker(payload) {
+		return
+	}
+
+	var envelope membershipEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil || envelope.ChannelID == nil {
+		return
+	}
+
+	change := membershipChange{
+		topic:     topic,
+		eventType: envelope.Type,
+		channelID: *envelope.ChannelID,
+		clients:   clients,
+	}
+	select {
+	case h.membership <- change:
+	case <-h.ctx.Done():
+	}
+}
+
+// hasMembershipMarker reports whether a payload may be a membership event
+func hasMembershipMarker(payload []byte) bool {
+	for _, marker := range membershipMarkers {
+		if bytes.Contains(payload, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// followMembership subscribes or detaches connections when an event changes
+// which channels they belong to. channel_joined and channel_left arrive on
+// the user's own topic; channel_deleted arrives on the channel's topic.
+func (h *Hub) followMembership(change membershipChange) {
+	topic, clients := change.topic, change.clients
+	channelTopic := chat.ChannelEventsTopic(change.channelID)
+
+	switch change.eventType {
+	case chat.EventChannelJoined:
+		for _, client := range clients {
+			if topic != chat.UserEventsTopic(client.userID) {
+				continue
+			}
+			if err := h.register(client, []string{channelTopic}); err != nil {
+				log.Printf("Failed to subscribe user %s to %s: %v", client.userID, channelTopic, err)
+				continue
+			}
+			h.markPresent(client, []string{change.channelID})
+		}
+	case chat.EventChannelLeft:
+		for _, client := range clients {
+			if topic != chat.UserEventsTopic(client.userID) {
+				continue
+			}
+			h.detach(client, []string{channelTopic})
+			if err := h.redis.RemoveFromChannelPresence(h.ctx, change.channelID, client.userID); err != nil {
+				log.Printf("Failed to remove user %s from channel presence: %v", client.userID, err)
+			}
+		}
+	case chat.EventChannelDeleted:
+		if topic != channelTopic {
+			return
+		}
+		for _, client := range clients {
+			h.detach(client, []string{channelTopic})
+		}
+	}
+}
+
+// wsClient is a single WebSocket connection
+type wsClient struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	userID    string
+	send      chan []byte
+	topics    map[string]struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// Set under the hub mutex once the client has been unregistered
+	unregistered bool
+}
+
+// newWSClient creates a client for an upgraded connection
+func newWSClient(hub *Hub, conn *websocket.Conn, userID string) *wsClient {
+	return &wsClient{
+		hub:    hub,
+		conn:   conn,
+		userID: userID,
+		send:   make(chan []byte, sendBufferSize),
+		topics: make(map[string]struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// close signals the write pump to shut the connection down
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// readPump reads frames from the connection until it fails, keeping the
+// read deadline alive with pong messages
+func (c *wsClient) readPump() {
+	defer func() {
+		c.hub.unregister(c)
+		c.close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("WebSocket read error for user %s: %v", c.userID, err)
+			}
+			return
+		}
+		c.handleFrame(payload)
+	}
+}
+
+// Frame types a client may send to manage its presence subscriptions
+const (
+	framePresenceSubscribe   = "presence_subscribe"
+	framePresenceUnsubscribe = "presence_unsubscribe"
+)
+
+// maxPresenceSubscriptions bounds how many users one connection may follow
+// the presence of
+const maxPresenceSubscriptions = 1000
+
+// presenceTopicPrefix is shared by every topic built by
+// presence.PresenceEventsTopic
+const presenceTopicPrefix = "presence:"
+
+// clientFrame is a signal sent by a client over its WebSocket
+type clientFrame struct {
+	Type      string   `json:"type"`
+	ChannelID string   `json:"channel_id"`
+	UserIDs   []string `json:"user_ids"`
+}
+
+// handleFrame acts on a signal from the client: typing signals and presence
+// subscription changes. Anything else is ignored.
+func (c *wsClient) handleFrame(payload []byte) {
+	var frame clientFrame
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		return
+	}
+
+	switch frame.Type {
+	case chat.EventTypingStart, chat.EventTypingStop:
+		c.relayTyping(frame.ChannelID, frame.Type)
+	case framePresenceSubscribe:
+		c.subscribePresence(frame.UserIDs)
+	case framePresenceUnsubscribe:
+		c.hub.detach(c, presenceTopics(frame.UserIDs))
+	}
+}
+
+// relayTyping passes a typing signal on to the channel. A connection
+// follows its user's channel memberships, so being subscribed to a
+// channel's topic is what authorizes typing in it.
+func (c *wsClient) relayTyping(channelID, signal string) {
+	if channelID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, writeWait)
+	defer cancel()
+
+	err := c.hub.typing.Signal(ctx, channelID, c.userID, signal, func() error {
+		if !c.hub.subscribed(c, chat.ChannelEventsTopic(channelID)) {
+			return chat.ErrNotChannelMember
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, chat.ErrNotChannelMember) {
+		log.Printf("Failed to relay typing signal for user %s: %v", c.userID, err)
+	}
+}
+
+// subscribePresence starts delivering presence changes of the given users
+// to the connection, up to maxPresenceSubscriptions in total. Users beyond
+// the limit are ignored.
+func (c *wsClient) subscribePresence(userIDs []string) {
+	topics := presenceTopics(userIDs)
+	room := maxPresenceSubscriptions - c.hub.countTopics(c, presenceTopicPrefix)
+	if room <= 0 {
+		return
+	}
+	if len(topics) > room {
+		topics = topics[:room]
+	}
+
+	if err := c.hub.register(c, topics); err != nil {
+		log.Printf("Failed to subscribe user %s to presence: %v", c.userID, err)
+	}
+}
+
+// presenceTopics returns the presence topics of the given users
+func presenceTopics(userIDs []string) []string {
+	topics := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID != "" {
+			topics = append(topics, presence.PresenceEventsTopic(userID))
+		}
+	}
+	return topics
+}
+
+// writePump writes queued events and periodic pings to the connection
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+			return
+		case payload := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
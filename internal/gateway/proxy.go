@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"real-time-chat-system/internal/discovery"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newProxyTransport creates the HTTP transport shared by all proxied requests
+func newProxyTransport(readTimeout time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.MaxIdleConnsPerHost = 100
+	// Upstreams must start answering within the gateway's read timeout
+	transport.ResponseHeaderTimeout = readTimeout
+	return transport
+}
+
+// proxyToService creates a handler that proxies requests to a service.
+// targetPath is the route on the upstream service; its ":param" segments are
+// filled, in order, from the path parameters of the gateway route.
+func (g *Gateway) proxyToService(serviceName, targetPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		instance, err := g.loadBalancer.GetInstance(serviceName)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Service unavailable",
+				"code":  "SERVICE_UNAVAILABLE",
+			})
+			return
+		}
+
+		target := &url.URL{Scheme: "http", Host: instanceHost(instance)}
+		upstreamPath := rewritePath(targetPath, c.Params)
+
+		// Bound the whole exchange, including a streamed body, by the write timeout
+		ctx, cancel := context.WithTimeout(c.Request.Context(), g.config.GetWriteTimeout())
+		defer cancel()
+
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.Out.URL.Path = upstreamPath
+				pr.Out.URL.RawPath = ""
+				pr.SetXForwarded()
+			},
+			Transport: g.transport,
+			// Flush immediately so streamed responses reach the client as they arrive
+			FlushInterval: -1,
+			ErrorHandler:  proxyErrorHandler(serviceName),
+		}
+
+		proxy.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+	}
+}
+
+// proxyErrorHandler reports upstream failures in the gateway's error format
+func proxyErrorHandler(serviceName string) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		status := http.StatusBadGateway
+		body := gin.H{
+			"error": "Upstream " + serviceName + " request failed",
+			"code":  "BAD_GATEWAY",
+		}
+
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			status = http.StatusGatewayTimeout
+			body = gin.H{
+				"error": "Upstream " + serviceName + " timed out",
+				"code":  "GATEWAY_TIMEOUT",
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// rewritePath substitutes the gateway route's parameters into an upstream route
+func rewritePath(targetPath string, params gin.Params) string {
+	segments := strings.Split(targetPath, "/")
+	next := 0
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		if next < len(params) {
+			segments[i] = params[next].Value
+			next++
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// instanceHost returns the host:port of a discovered service instance
+func instanceHost(instance *discovery.ServiceInstance) string {
+	// Service ports are registered in listen-address form, e.g. ":8081"
+	return net.JoinHostPort(instance.Address, strings.TrimPrefix(instance.Port, ":"))
+}
@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Route classes with separate rate limit buckets
+const (
+	rateLimitDefault     = "default"
+	rateLimitMessageSend = "message_send"
+	rateLimitHistoryRead = "history_read"
+	rateLimitWebSocket   = "websocket_connect"
+)
+
+// rateLimitTimeout bounds the Redis round trip so a slow Redis cannot stall requests
+const rateLimitTimeout = 100 * time.Millisecond
+
+// limitFor returns the configured limit for a route class
+func (g *Gateway) limitFor(class string) int {
+	var limit int
+	switch class {
+	case rateLimitMessageSend:
+		limit = g.config.RateLimits.MessageSend
+	case rateLimitHistoryRead:
+		limit = g.config.RateLimits.HistoryRead
+	case rateLimitWebSocket:
+		limit = g.config.RateLimits.WebSocketConnect
+	}
+	if limit <= 0 {
+		limit = g.config.RateLimit
+	}
+	return limit
+}
+
+// rateLimitMiddleware limits requests in a route class per authenticated
+// user, or per client IP for anonymous requests. It fails open when Redis is
+// unavailable.
+func (g *Gateway) rateLimitMiddleware(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := g.limitFor(class)
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		var key string
+		if userID := identity.UserID(c); userID != "" {
+			key = fmt.Sprintf("ratelimit:%s:user:%s", class, userID)
+		} else {
+			key = fmt.Sprintf("ratelimit:%s:ip:%s", class, c.ClientIP())
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), rateLimitTimeout)
+		defer cancel()
+
+		result, err := g.redis.AllowRequest(ctx, key, limit, g.config.RateLimits.GetWindow())
+		if err != nil {
+			log.Printf("Rate limiter unavailable, allowing request: %v", err)
+			c.Next()
+			return
+		}
+
+		resetSeconds := strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds())))
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", resetSeconds)
+
+		if !result.Allowed {
+			c.Header("Retry-After", resetSeconds)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "Rate limit exceeded",
+				"code":  "RATE_LIMITED",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,175 @@
+// Package media generates display previews for uploaded images: thumbnails,
+// dimensions and a blurhash placeholder, and strips privacy-sensitive
+// metadata from the originals.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"sort"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// blurhashEdge is the size images are scaled to before computing their
+// blurhash; the hash only captures a few colour components, so more pixels
+// would only cost time
+const blurhashEdge = 32
+
+// thumbnailQuality is the JPEG quality of opaque thumbnails
+const thumbnailQuality = 80
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image is too large to process")
+)
+
+// supportedTypes maps the content types previews are generated for to the
+// format names reported by image.Decode
+var supportedTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Thumbnail is a scaled-down copy of an image that fits in a square of
+// MaxEdge pixels
+type Thumbnail struct {
+	MaxEdge     int
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// Preview is what clients need to lay out and show an image before the
+// original has downloaded
+type Preview struct {
+	Width      int
+	Height     int
+	Blurhash   string
+	Thumbnails []Thumbnail
+}
+
+// Supported reports whether previews can be generated for a content type
+func Supported(contentType string) bool {
+	_, ok := supportedTypes[contentType]
+	return ok
+}
+
+// Generate decodes an image and builds its preview. A thumbnail is made for
+// each of sizes smaller than the image; dimensions, thumbnails and the
+// blurhash all follow the EXIF orientation. Images with more than maxPixels
+// pixels are rejected before being decoded. Animated GIFs are previewed from
+// their first frame.
+func Generate(data []byte, sizes []int, maxPixels int64) (*Preview, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if !formatSupported(format) {
+		return nil, ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	orientation := Orientation(data)
+	bounds := src.Bounds()
+	width, height := orientedSize(bounds.Dx(), bounds.Dy(), orientation)
+
+	preview := &Preview{Width: width, Height: height}
+
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+	for _, edge := range sorted {
+		if edge <= 0 || (width <= edge && height <= edge) {
+			continue
+		}
+		thumbnail, err := makeThumbnail(src, orientation, edge, draw.CatmullRom)
+		if err != nil {
+			return nil, err
+		}
+		preview.Thumbnails = append(preview.Thumbnails, *thumbnail)
+	}
+
+	small := orient(scale(src, blurhashEdge, draw.ApproxBiLinear), orientation)
+	xComponents, yComponents := 4, 3
+	if height > width {
+		xComponents, yComponents = 3, 4
+	}
+	preview.Blurhash = Blurhash(small, xComponents, yComponents)
+
+	return preview, nil
+}
+
+// makeThumbnail scales src to fit in a square of edge pixels, turns it
+// upright and encodes it: opaque images as JPEG, others as PNG
+func makeThumbnail(src image.Image, orientation, edge int, scaler draw.Scaler) (*Thumbnail, error) {
+	img := orient(scale(src, edge, scaler), orientation)
+
+	var buf bytes.Buffer
+	contentType := "image/png"
+	if img.Opaque() {
+		contentType = "image/jpeg"
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+	} else if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	bounds := img.Bounds()
+	return &Thumbnail{
+		MaxEdge:     edge,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		ContentType: contentType,
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// scale resizes src to fit in a square of edge pixels. It works in the
+// stored orientation; fitting a square does not depend on which side ends
+// up as the width.
+func scale(src image.Image, edge int, scaler draw.Scaler) *image.NRGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > edge || height > edge {
+		if width >= height {
+			height = max(1, height*edge/width)
+			width = edge
+		} else {
+			width = max(1, width*edge/height)
+			height = edge
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	scaler.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// formatSupported reports whether a decoded format is one previews are
+// generated for
+func formatSupported(format string) bool {
+	for _, supported := range supportedTypes {
+		if format == supported {
+			return true
+		}
+	}
+	return false
+}
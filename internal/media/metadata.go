@@ -0,0 +1,349 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+)
+
+// orientationTag is the EXIF tag holding how the stored pixels must be
+// rotated or flipped for display
+const orientationTag = 0x0112
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader    = []byte("Exif\x00\x00")
+)
+
+// StripMetadata removes EXIF, XMP, IPTC and text metadata, which can carry
+// locations, device details and editing history, from JPEG, PNG and WebP
+// images. The orientation is kept, in a minimal EXIF block of its own, so
+// images still display upright. Other formats and data that cannot be
+// parsed are returned unchanged.
+func StripMetadata(data []byte) []byte {
+	orientation := Orientation(data)
+
+	var stripped []byte
+	switch {
+	case bytes.HasPrefix(data, jpegSignature):
+		stripped = stripJPEG(data, orientation)
+	case bytes.HasPrefix(data, pngSignature):
+		stripped = stripPNG(data, orientation)
+	case isWebP(data):
+		stripped = stripWebP(data, orientation)
+	}
+
+	if stripped == nil {
+		return data
+	}
+	return stripped
+}
+
+// Orientation returns an image's EXIF orientation, from 1 (upright) to 8.
+// Images without one are upright.
+func Orientation(data []byte) int {
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(data, jpegSignature):
+		walkJPEG(data, func(marker byte, segment []byte) {
+			if marker == 0xE1 && tiff == nil && bytes.HasPrefix(segment[4:], exifHeader) {
+				tiff = segment[4+len(exifHeader):]
+			}
+		})
+	case bytes.HasPrefix(data, pngSignature):
+		walkPNG(data, func(chunkType string, chunk []byte) {
+			if chunkType == "eXIf" && tiff == nil {
+				tiff = chunk[8 : len(chunk)-4]
+			}
+		})
+	case isWebP(data):
+		walkWebP(data, func(fourCC string, chunk []byte) {
+			if fourCC == "EXIF" && tiff == nil {
+				tiff = bytes.TrimPrefix(chunk[8:], exifHeader)
+			}
+		})
+	}
+
+	if orientation := tiffOrientation(tiff); orientation >= 1 && orientation <= 8 {
+		return orientation
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of an EXIF
+// TIFF structure, returning 0 when there is none
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// Orientation is a single SHORT stored in the value field
+		if order.Uint16(tiff[entry:]) == orientationTag && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// orientationTIFF builds an EXIF TIFF structure holding only the orientation
+func orientationTIFF(orientation int) []byte {
+	tiff := make([]byte, 26)
+	copy(tiff, "MM\x00*")
+	binary.BigEndian.PutUint32(tiff[4:], 8)                    // first IFD
+	binary.BigEndian.PutUint16(tiff[8:], 1)                    // entry count
+	binary.BigEndian.PutUint16(tiff[10:], orientationTag)      // tag
+	binary.BigEndian.PutUint16(tiff[12:], 3)                   // SHORT
+	binary.BigEndian.PutUint32(tiff[14:], 1)                   // value count
+	binary.BigEndian.PutUint16(tiff[18:], uint16(orientation)) // value
+	// The next IFD offset at tiff[22:26] stays zero
+	return tiff
+}
+
+// walkJPEG calls fn for each marker segment before the image data, with the
+// segment's marker and its bytes from the 0xFF prefix on. It returns the
+// offset of the start of scan marker, or 0 if the stream is malformed.
+func walkJPEG(data []byte, fn func(marker byte, segment []byte)) int {
+	i := len(jpegSignature)
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 0
+		}
+		marker := data[i+1]
+		if marker == 0xDA {
+			return i
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0
+		}
+		fn(marker, data[i:i+2+length])
+		i += 2 + length
+	}
+	return 0
+}
+
+// stripJPEG drops APP1 (EXIF and XMP), APP13 (IPTC) and comment segments.
+// The orientation segment goes after the JFIF header, which must come first.
+func stripJPEG(data []byte, orientation int) []byte {
+	var kept [][]byte
+	scan := walkJPEG(data, func(marker byte, segment []byte) {
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			kept = append(kept, segment)
+		}
+	})
+	if scan == 0 {
+		return nil
+	}
+
+	out := append([]byte(nil), jpegSignature...)
+	insertAt := 0
+	if len(kept) > 0 && kept[0][1] == 0xE0 {
+		insertAt = 1
+	}
+	for i, segment := range kept {
+		if i == insertAt {
+			out = appendJPEGOrientation(out, orientation)
+		}
+		out = append(out, segment...)
+	}
+	if insertAt == len(kept) {
+		out = appendJPEGOrientation(out, orientation)
+	}
+	return append(out, data[scan:]...)
+}
+
+// appendJPEGOrientation appends an APP1 segment holding the orientation,
+// unless the image is already upright
+func appendJPEGOrientation(out []byte, orientation int) []byte {
+	if orientation == 1 {
+		return out
+	}
+	payload := append(append([]byte(nil), exifHeader...), orientationTIFF(orientation)...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	return append(out, payload...)
+}
+
+// walkPNG calls fn for each chunk with its type and its bytes, including
+// the length, type and CRC. It returns false if the stream is malformed.
+func walkPNG(data []byte, fn func(chunkType string, chunk []byte)) bool {
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+12 > len(data) {
+			return false
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if length < 0 || i+12+length > len(data) {
+			return false
+		}
+		fn(string(data[i+4:i+8]), data[i:i+12+length])
+		i += 12 + length
+	}
+	return true
+}
+
+// stripPNG drops eXIf and text chunks. The orientation chunk goes straight
+// after the header, since readers ignore eXIf after the image data.
+func stripPNG(data []byte, orientation int) []byte {
+	out := append([]byte(nil), pngSignature...)
+	ok := walkPNG(data, func(chunkType string, chunk []byte) {
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+			return
+		}
+		out = append(out, chunk...)
+		if chunkType == "IHDR" && orientation != 1 {
+			out = appendPNGChunk(out, "eXIf", orientationTIFF(orientation))
+		}
+	})
+	if !ok {
+		return nil
+	}
+	return out
+}
+
+// appendPNGChunk appends a chunk with its length and CRC
+func appendPNGChunk(out []byte, chunkType string, payload []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(payload)))
+	start := len(out)
+	out = append(out, chunkType...)
+	out = append(out, payload...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+}
+
+// isWebP reports whether data is a WebP RIFF container
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// walkWebP calls fn for each chunk with its FourCC and its bytes, including
+// the header and any padding byte. It returns false if the stream is
+// malformed.
+func walkWebP(data []byte, fn func(fourCC string, chunk []byte)) bool {
+	i := 12
+	for i < len(data) {
+		if i+8 > len(data) {
+			return false
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return false
+		}
+		fn(string(data[i:i+4]), data[i:end])
+		i = end
+	}
+	return true
+}
+
+// stripWebP drops EXIF and XMP chunks and updates the extended header's
+// flags to match. The orientation chunk goes at the end, where EXIF belongs.
+func stripWebP(data []byte, orientation int) []byte {
+	const (
+		exifFlag = 0x08
+		xmpFlag  = 0x04
+	)
+
+	out := append([]byte(nil), data[:12]...)
+	extended := -1
+	ok := walkWebP(data, func(fourCC string, chunk []byte) {
+		switch fourCC {
+		case "EXIF", "XMP ":
+			return
+		case "VP8X":
+			// The flags byte follows the chunk header; a VP8X chunk too
+			// short to hold its fields is left alone
+			if len(chunk) >= 18 {
+				extended = len(out)
+			}
+		}
+		out = append(out, chunk...)
+	})
+	if !ok {
+		return nil
+	}
+
+	// Only the extended format can carry metadata
+	if extended >= 0 {
+		out[extended+8] &^= exifFlag | xmpFlag
+		if orientation != 1 {
+			out[extended+8] |= exifFlag
+			tiff := orientationTIFF(orientation)
+			out = append(out, "EXIF"...)
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(tiff)))
+			out = append(out, tiff...)
+		}
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out
+}
+
+// orientedSize returns the displayed size of an image stored as width by
+// height with the given orientation
+func orientedSize(width, height, orientation int) (int, int) {
+	if orientation >= 5 {
+		return height, width
+	}
+	return width, height
+}
+
+// orient rotates and flips img so it displays upright
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	outWidth, outHeight := orientedSize(width, height, orientation)
+	out := image.NewNRGBA(image.Rect(0, 0, outWidth, outHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = width-1-x, y
+			case 3: // rotated 180°
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // mirrored along the main diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = height-1-y, x
+			case 7: // mirrored along the anti-diagonal
+				dx, dy = height-1-y, width-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, width-1-x
+			}
+			src := img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			dst := out.PixOffset(dx, dy)
+			copy(out.Pix[dst:dst+4], img.Pix[src:src+4])
+		}
+	}
+	return out
+}
@@ -0,0 +1,31 @@
+package presence
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunChannelSweeper periodically removes members from channel presence sets
+// once gateways have stopped refreshing them for longer than the TTL, until
+// ctx is cancelled
+func (s *Service) RunChannelSweeper(ctx context.Context) {
+	ticker := time.NewTicker(s.config.GetSweepInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.redis.PruneChannelPresence(ctx, time.Now().Add(-s.config.GetTTL()))
+			if err != nil {
+				log.Printf("Failed to sweep channel presence: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Removed %d stale channel presence entries", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package presence
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// defaultDeviceID names the device of heartbeats that do not give one
+const defaultDeviceID = "default"
+
+// maxDeviceIDLength bounds the device IDs clients may send
+const maxDeviceIDLength = 64
+
+// statusPriority ranks statuses when aggregating devices; the highest
+// ranked status among a user's live devices wins. Invisible only ever
+// counts for the user's own view.
+var statusPriority = map[string]int{
+	StatusOnline:    4,
+	StatusAway:      3,
+	StatusDND:       2,
+	StatusInvisible: 1,
+}
+
+// deviceRecords are the stored records of a user's devices
+type deviceRecords []Record
+
+// decodeDevices parses the stored records of a user's devices, ordered by
+// device ID. Records that cannot be parsed are skipped.
+func decodeDevices(fields map[string]string) deviceRecords {
+	devices := make(deviceRecords, 0, len(fields))
+	for deviceID, payload := range fields {
+		var record Record
+		if err := json.Unmarshal([]byte(payload), &record); err != nil {
+			continue
+		}
+		record.DeviceID = deviceID
+		devices = append(devices, record)
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DeviceID < devices[j].DeviceID })
+	return devices
+}
+
+// with returns the devices with record replacing any earlier record of the
+// same device
+func (d deviceRecords) with(record Record) deviceRecords {
+	devices := make(deviceRecords, 0, len(d)+1)
+	for _, existing := range d {
+		if existing.DeviceID != record.DeviceID {
+			devices = append(devices, existing)
+		}
+	}
+	return append(devices, record)
+}
+
+// expired returns the IDs of devices whose records have lapsed at now
+func (d deviceRecords) expired(now time.Time) []string {
+	var deviceIDs []string
+	for _, record := range d {
+		if !record.ExpiresAt.After(now) {
+			deviceIDs = append(deviceIDs, record.DeviceID)
+		}
+	}
+	return deviceIDs
+}
+
+// nextExpiry returns the earliest time after now at which a visible device
+// lapses, which is the next time the status others see can change without
+// a heartbeat
+func (d deviceRecords) nextExpiry(now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, record := range d {
+		if record.Status == StatusInvisible || !record.ExpiresAt.After(now) {
+			continue
+		}
+		if next.IsZero() || record.ExpiresAt.Before(next) {
+			next = record.ExpiresAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// view returns the presence a viewer may see at the given time, aggregated
+// across the devices live then. Invisible devices are ignored for everyone
+// but the user themselves, who also sees the list of their live devices.
+func (d deviceRecords) view(userID, viewerID string, at time.Time) *Presence {
+	presence := &Presence{UserID: userID, Status: StatusOffline}
+	self := userID == viewerID
+
+	var lastActive time.Time
+	for _, record := range d {
+		if !record.ExpiresAt.After(at) || (record.Status == StatusInvisible && !self) {
+			continue
+		}
+
+		if statusPriority[record.Status] > statusPriority[presence.Status] {
+			presence.Status = record.Status
+		}
+		if record.LastActive.After(lastActive) {
+			lastActive = record.LastActive
+		}
+		if self {
+			presence.Devices = append(presence.Devices, Device{
+				DeviceID:   record.DeviceID,
+				Status:     record.Status,
+				LastActive: record.LastActive,
+			})
+		}
+	}
+
+	if !lastActive.IsZero() {
+		presence.LastActive = &lastActive
+	}
+	return presence
+}
+
+// Connected reports whether a user with the given stored device records has
+// any live device at the given time, whatever its status. The call service
+// uses it to find calls everyone dropped out of without leaving.
+func Connected(fields map[string]string, at time.Time) bool {
+	for _, record := range decodeDevices(fields) {
+		if record.ExpiresAt.After(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// Invisible reports whether a user with the given stored device records is
+// hidden from others at the given time: they have live devices and all of
+// them are invisible. Gateways use it to keep invisible users out of
+// channel presence while they are connected.
+func Invisible(fields map[string]string, at time.Time) bool {
+	live := false
+	for _, record := range decodeDevices(fields) {
+		if !record.ExpiresAt.After(at) {
+			continue
+		}
+		if record.Status != StatusInvisible {
+			return false
+		}
+		live = true
+	}
+	return live
+}
@@ -0,0 +1,27 @@
+package presence
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrInvalidStatus = errors.New("status must be online, away, dnd or invisible")
+	ErrInvalidDevice = errors.New("device_id must be at most 64 characters")
+	ErrInvalidQuery  = errors.New("user_ids must list between 1 and 1000 users")
+
+	ErrInvalidCustomStatus = errors.New("invalid custom status")
+)
+
+// writeError maps service errors to HTTP responses
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidStatus), errors.Is(err, ErrInvalidDevice), errors.Is(err, ErrInvalidQuery),
+		errors.Is(err, ErrInvalidCustomStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,158 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"real-time-chat-system/internal/chat"
+	redisclient "real-time-chat-system/internal/redis"
+	"time"
+)
+
+// EventPresenceChanged is published on a user's presence topic whenever the
+// status others see for them changes
+const EventPresenceChanged = "presence_changed"
+
+// sweepBatchSize bounds how many expired users one sweep pass handles
+const sweepBatchSize = 500
+
+// PresenceEventsTopic returns the Redis pub/sub topic carrying a user's
+// presence changes to their subscribers
+func PresenceEventsTopic(userID string) string {
+	return fmt.Sprintf("presence:%s:events", userID)
+}
+
+// announceTransition publishes a presence change if the status others see
+// differs between before and after
+func (s *Service) announceTransition(ctx context.Context, before, after *Presence) {
+	if before.Status == after.Status {
+		return
+	}
+
+	if after.Status == StatusOffline && before.LastActive != nil {
+		// Leaving, or going invisible, happens as of the last visible activity
+		after.LastSeen = before.LastActive
+	}
+
+	// Events carry the whole presence, so an absent custom status means none
+	customStatus, err := s.getCustomStatus(ctx, after.UserID)
+	if err != nil {
+		log.Printf("Failed to announce presence of user %s: %v", after.UserID, err)
+		return
+	}
+	after.CustomStatus = customStatus
+	s.publishPresence(ctx, after)
+}
+
+// publishPresence sends a presence_changed event on the user's topic. Failures
+// are logged rather than returned: the stored presence is already correct
+// and subscribers can recover it with a lookup.
+func (s *Service) publishPresence(ctx context.Context, presence *Presence) {
+	event := chat.WebSocketEvent{
+		Type:      EventPresenceChanged,
+		Timestamp: time.Now(),
+		Data:      presence,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal presence event: %v", err)
+		return
+	}
+	if err := s.redis.Publish(ctx, PresenceEventsTopic(presence.UserID), payload); err != nil {
+		log.Printf("Failed to publish presence event for user %s: %v", presence.UserID, err)
+	}
+}
+
+// trackExpiry records when the next of a user's visible devices lapses, so
+// the sweeper can announce the status change it may cause. Users with no
+// visible devices already look offline and are not tracked.
+func (s *Service) trackExpiry(ctx context.Context, userID string, devices deviceRecords, now time.Time) error {
+	next, ok := devices.nextExpiry(now)
+	if !ok {
+		return s.redis.UntrackPresenceExpiry(ctx, userID)
+	}
+	return s.redis.TrackPresenceExpiry(ctx, userID, next)
+}
+
+// RunExpirySweeper periodically announces users whose status changed because
+// a device lapsed without a further heartbeat, or whose custom status
+// expired, until ctx is cancelled.
+// Several instances may run at once; each expiry is claimed and announced by
+// only one.
+func (s *Service) RunExpirySweeper(ctx context.Context) {
+	ticker := time.NewTicker(s.config.GetSweepInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sweepExpired(ctx); err != nil {
+				log.Printf("Failed to sweep expired presence: %v", err)
+			}
+		}
+	}
+}
+
+// sweepExpired handles every device and custom status expiry that has
+// fallen due since the last pass
+func (s *Service) sweepExpired(ctx context.Context) error {
+	if err := sweepDue(ctx, s.redis.DuePresenceExpiries, s.expire); err != nil {
+		return err
+	}
+	return sweepDue(ctx, s.redis.DueCustomStatusExpiries, s.expireCustomStatus)
+}
+
+// sweepDue passes each expiry listed by due to handle, batch by batch,
+// until none are left
+func sweepDue(ctx context.Context,
+	due func(context.Context, time.Time, int) ([]redisclient.PresenceExpiry, error),
+	handle func(context.Context, redisclient.PresenceExpiry, time.Time) error,
+) error {
+	for {
+		now := time.Now()
+		expiries, err := due(ctx, now, sweepBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, expiry := range expiries {
+			if err := handle(ctx, expiry, now); err != nil {
+				return err
+			}
+		}
+
+		if len(expiries) < sweepBatchSize {
+			return nil
+		}
+	}
+}
+
+// expire announces the change in a user's status caused by devices lapsing
+// since their expiry fell due, if this sweeper claims it, and tracks the
+// next device to lapse. The status just before the expiry is the one last
+// announced, since any heartbeat in between would have moved the expiry.
+func (s *Service) expire(ctx context.Context, expiry redisclient.PresenceExpiry, now time.Time) error {
+	claimed, err := s.redis.ClaimPresenceExpiry(ctx, expiry.UserID, now)
+	if err != nil || !claimed {
+		return err
+	}
+
+	devices, err := s.getDevices(ctx, expiry.UserID)
+	if err != nil {
+		return err
+	}
+
+	before := devices.view(expiry.UserID, "", expiry.At.Add(-time.Millisecond))
+	s.announceTransition(ctx, before, devices.view(expiry.UserID, "", now))
+
+	// A concurrent heartbeat may already track a later expiry; only add one
+	// here, never remove it
+	if next, ok := devices.nextExpiry(now); ok {
+		return s.redis.TrackPresenceExpiry(ctx, expiry.UserID, next)
+	}
+	return nil
+}
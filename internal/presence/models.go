@@ -0,0 +1,68 @@
+package presence
+
+import "time"
+
+// Presence statuses a client may report in a heartbeat
+const (
+	StatusOnline    = "online"
+	StatusAway      = "away"
+	StatusDND       = "dnd"
+	StatusInvisible = "invisible"
+)
+
+// StatusOffline is reported for users without a live heartbeat, and to
+// others for users who are invisible
+const StatusOffline = "offline"
+
+// HeartbeatRequest represents a presence heartbeat from one of a user's
+// devices
+type HeartbeatRequest struct {
+	Status   string `json:"status"`    // online (default), away, dnd or invisible
+	DeviceID string `json:"device_id"` // defaults to "default"
+}
+
+// Record is the presence state stored for one of a user's devices until it
+// expires
+type Record struct {
+	Status     string    `json:"status"`
+	DeviceID   string    `json:"device_id"`
+	LastActive time.Time `json:"last_active"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Device is one of a user's live devices, shown only to the user themselves
+type Device struct {
+	DeviceID   string    `json:"device_id"`
+	Status     string    `json:"status"`
+	LastActive time.Time `json:"last_active"`
+}
+
+// Presence is a user's presence as seen by the requesting user. Status is
+// aggregated across the user's live devices.
+type Presence struct {
+	UserID       string        `json:"user_id"`
+	Status       string        `json:"status"`
+	LastActive   *time.Time    `json:"last_active,omitempty"`
+	LastSeen     *time.Time    `json:"last_seen,omitempty"`
+	CustomStatus *CustomStatus `json:"custom_status,omitempty"`
+	Devices      []Device      `json:"devices,omitempty"`
+}
+
+// CustomStatus is an emoji and text a user shows alongside their status,
+// cleared automatically at ExpiresAt if one is set
+type CustomStatus struct {
+	Emoji     string     `json:"emoji,omitempty"`
+	Text      string     `json:"text,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// QueryRequest asks for the presence of many users at once
+type QueryRequest struct {
+	UserIDs []string `json:"user_ids" binding:"required"`
+}
+
+// QueryResponse lists presences in the order the users were requested,
+// without duplicates
+type QueryResponse struct {
+	Presences []Presence `json:"presences"`
+}
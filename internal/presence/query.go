@@ -0,0 +1,85 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxQueryUsers bounds how many users one presence query may ask about
+const maxQueryUsers = 1000
+
+// QueryPresence returns the presence of many users as seen by viewerID.
+// Users are read from Redis in pipelined batches of the configured size.
+func (s *Service) QueryPresence(ctx context.Context, viewerID string, userIDs []string) (*QueryResponse, error) {
+	userIDs = uniqueUserIDs(userIDs)
+	if len(userIDs) == 0 || len(userIDs) > maxQueryUsers {
+		return nil, ErrInvalidQuery
+	}
+
+	presences := make([]Presence, 0, len(userIDs))
+	batchSize := s.config.GetBatchSize()
+	for start := 0; start < len(userIDs); start += batchSize {
+		end := min(start+batchSize, len(userIDs))
+		batch := userIDs[start:end]
+
+		entries, err := s.redis.GetPresenceBatch(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load presence: %w", err)
+		}
+
+		now := time.Now()
+		for i, entry := range entries {
+			presence := decodeDevices(entry.Devices).view(batch[i], viewerID, now)
+			presence.CustomStatus = decodeCustomStatus(entry.CustomStatus)
+			if presence.Status == StatusOffline && !entry.LastSeen.IsZero() {
+				lastSeen := entry.LastSeen
+				presence.LastSeen = &lastSeen
+			}
+			presences = append(presences, *presence)
+		}
+	}
+
+	return &QueryResponse{Presences: presences}, nil
+}
+
+// uniqueUserIDs trims user IDs and drops blanks and duplicates, keeping the
+// first occurrence of each
+func uniqueUserIDs(userIDs []string) []string {
+	seen := make(map[string]struct{}, len(userIDs))
+	unique := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		userID = strings.TrimSpace(userID)
+		if userID == "" {
+			continue
+		}
+		if _, ok := seen[userID]; ok {
+			continue
+		}
+		seen[userID] = struct{}{}
+		unique = append(unique, userID)
+	}
+	return unique
+}
+
+// queryPresenceHandler handles bulk presence lookups
+func (s *Service) queryPresenceHandler(c *gin.Context) {
+	var req QueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := s.QueryPresence(c.Request.Context(), identity.UserID(c), req.UserIDs)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -1,26 +1,41 @@
 package presence
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"real-time-chat-system/internal/config"
 	"real-time-chat-system/internal/health"
+	"real-time-chat-system/internal/identity"
 	redisclient "real-time-chat-system/internal/redis"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
 )
 
+// lastSeenRetention is how long a user's last_seen time is kept after their
+// last visible heartbeat
+const lastSeenRetention = 30 * 24 * time.Hour
+
+// Service represents the presence service
 type Service struct {
 	config        *config.PresenceConfig
 	healthChecker *health.Checker
 	redis         *redisclient.Client
+	signer        *identity.Signer
 }
 
 // New creates a new Presence Service instance
-func New(cfg *config.PresenceConfig, healthChecker *health.Checker, redisClient *redisclient.Client) (*Service, error) {
+func New(cfg *config.PresenceConfig, healthChecker *health.Checker, redisClient *redisclient.Client, signer *identity.Signer) (*Service, error) {
 	service := &Service{
 		config:        cfg,
 		healthChecker: healthChecker,
 		redis:         redisClient,
+		signer:        signer,
 	}
 
 	// Add health checks
@@ -47,32 +62,160 @@ func (s *Service) Router() http.Handler {
 
 	// Service endpoints
 	v1 := router.Group("/v1")
+	v1.Use(s.signer.Middleware())
 	{
 		v1.POST("/heartbeat", s.updateHeartbeat)
 		v1.GET("/presence/:userID", s.getPresence)
+		v1.POST("/presence/query", s.queryPresenceHandler)
+		v1.PUT("/status", s.setCustomStatusHandler)
+		v1.DELETE("/status", s.clearCustomStatusHandler)
 	}
 
 	return router
 }
 
+// Heartbeat records the presence of one of a user's devices, keeping it
+// alive for the configured TTL, and announces the user's aggregate status to
+// subscribers if the status others see changed. Visible heartbeats also move
+// the user's last_seen time forward; invisible ones do not, so others cannot
+// tell when an invisible user was around.
+func (s *Service) Heartbeat(ctx context.Context, userID string, req HeartbeatRequest) (*Presence, error) {
+	status := req.Status
+	if status == "" {
+		status = StatusOnline
+	}
+	if !validStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+
+	deviceID := strings.TrimSpace(req.DeviceID)
+	if deviceID == "" {
+		deviceID = defaultDeviceID
+	}
+	if len(deviceID) > maxDeviceIDLength {
+		return nil, ErrInvalidDevice
+	}
+
+	now := time.Now().UTC()
+	record := Record{
+		Status:     status,
+		DeviceID:   deviceID,
+		LastActive: now,
+		ExpiresAt:  now.Add(s.config.GetTTL()),
+	}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal presence: %w", err)
+	}
+
+	fields, err := s.redis.SwapDevicePresence(ctx, userID, deviceID, string(payload), s.config.GetTTL())
+	if err != nil {
+		return nil, fmt.Errorf("failed to store presence: %w", err)
+	}
+	previous := decodeDevices(fields)
+	current := previous.with(record)
+
+	// Lapsed devices linger in the hash until the next heartbeat prunes them
+	if expired := previous.expired(now); len(expired) > 0 {
+		if err := s.redis.RemoveDevicePresence(ctx, userID, expired...); err != nil {
+			return nil, fmt.Errorf("failed to prune expired devices: %w", err)
+		}
+	}
+	if status != StatusInvisible {
+		if err := s.redis.SetLastSeen(ctx, userID, now, lastSeenRetention); err != nil {
+			return nil, fmt.Errorf("failed to store last seen time: %w", err)
+		}
+	}
+	if err := s.trackExpiry(ctx, userID, current, now); err != nil {
+		return nil, fmt.Errorf("failed to track presence expiry: %w", err)
+	}
+
+	s.announceTransition(ctx, previous.view(userID, "", now), current.view(userID, "", now))
+
+	presence := current.view(userID, userID, now)
+	if presence.CustomStatus, err = s.getCustomStatus(ctx, userID); err != nil {
+		return nil, err
+	}
+	return presence, nil
+}
+
+// GetPresence returns a user's presence and custom status as seen by
+// viewerID. Users without a live device are offline and carry their
+// last_seen time if known.
+func (s *Service) GetPresence(ctx context.Context, viewerID, userID string) (*Presence, error) {
+	devices, err := s.getDevices(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	presence := devices.view(userID, viewerID, time.Now())
+	if presence.CustomStatus, err = s.getCustomStatus(ctx, userID); err != nil {
+		return nil, err
+	}
+	if presence.Status != StatusOffline {
+		return presence, nil
+	}
+
+	lastSeen, err := s.redis.GetLastSeen(ctx, userID)
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return presence, nil
+		}
+		return nil, fmt.Errorf("failed to load last seen time: %w", err)
+	}
+	presence.LastSeen = &lastSeen
+
+	return presence, nil
+}
+
+// getDevices loads the stored records of a user's devices, including any
+// that have lapsed but not yet been pruned
+func (s *Service) getDevices(ctx context.Context, userID string) (deviceRecords, error) {
+	fields, err := s.redis.GetPresence(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load presence: %w", err)
+	}
+	return decodeDevices(fields), nil
+}
+
+// validStatus reports whether a client may send status in a heartbeat
+func validStatus(status string) bool {
+	switch status {
+	case StatusOnline, StatusAway, StatusDND, StatusInvisible:
+		return true
+	}
+	return false
+}
+
 // updateHeartbeat handles presence heartbeat updates
 func (s *Service) updateHeartbeat(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Presence service - heartbeat endpoint",
-		"service": "presence-service",
-		"status":  "Redis connected",
-	})
+	var req HeartbeatRequest
+	// An empty body is a plain online heartbeat
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	presence, err := s.Heartbeat(c.Request.Context(), identity.UserID(c), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, presence)
 }
 
 // getPresence handles presence status retrieval
 func (s *Service) getPresence(c *gin.Context) {
-	userID := c.Param("userID")
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Presence Service - get presence endpoint",
-		"service": "presence-service",
-		"userID":  userID,
-		"status":  "Redis Connected",
-	})
+	presence, err := s.GetPresence(c.Request.Context(), identity.UserID(c), c.Param("userID"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, presence)
 }
 
 // metricsHandler exposes Prometheus metrics
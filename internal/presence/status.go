@@ -0,0 +1,167 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"real-time-chat-system/internal/identity"
+	redisclient "real-time-chat-system/internal/redis"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Custom status length limits
+const (
+	maxCustomStatusEmoji = 64  // bytes, enough for a shortcode or a ZWJ sequence
+	maxCustomStatusText  = 100 // characters
+)
+
+// SetCustomStatus replaces a user's custom status and announces it to
+// subscribers. A status with an expiry clears itself when it passes.
+func (s *Service) SetCustomStatus(ctx context.Context, userID string, status CustomStatus) (*CustomStatus, error) {
+	status.Emoji = strings.TrimSpace(status.Emoji)
+	status.Text = strings.TrimSpace(status.Text)
+	if status.Emoji == "" && status.Text == "" {
+		return nil, fmt.Errorf("%w: emoji or text is required", ErrInvalidCustomStatus)
+	}
+	if len(status.Emoji) > maxCustomStatusEmoji || utf8.RuneCountInString(status.Text) > maxCustomStatusText {
+		return nil, fmt.Errorf("%w: emoji or text is too long", ErrInvalidCustomStatus)
+	}
+
+	var ttl time.Duration
+	if status.ExpiresAt != nil {
+		expiresAt := status.ExpiresAt.UTC()
+		ttl = time.Until(expiresAt)
+		if ttl <= 0 {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidCustomStatus)
+		}
+		status.ExpiresAt = &expiresAt
+	}
+
+	payload, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal custom status: %w", err)
+	}
+	if err := s.redis.SetCustomStatus(ctx, userID, string(payload), ttl); err != nil {
+		return nil, fmt.Errorf("failed to store custom status: %w", err)
+	}
+
+	if status.ExpiresAt != nil {
+		err = s.redis.TrackCustomStatusExpiry(ctx, userID, *status.ExpiresAt)
+	} else {
+		err = s.redis.UntrackCustomStatusExpiry(ctx, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to track custom status expiry: %w", err)
+	}
+
+	s.announceCustomStatus(ctx, userID)
+	return &status, nil
+}
+
+// ClearCustomStatus removes a user's custom status, announcing the change
+// if they had one
+func (s *Service) ClearCustomStatus(ctx context.Context, userID string) error {
+	cleared, err := s.redis.DeleteCustomStatus(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear custom status: %w", err)
+	}
+	if err := s.redis.UntrackCustomStatusExpiry(ctx, userID); err != nil {
+		return fmt.Errorf("failed to track custom status expiry: %w", err)
+	}
+
+	if cleared {
+		s.announceCustomStatus(ctx, userID)
+	}
+	return nil
+}
+
+// getCustomStatus loads a user's custom status, or nil if they have none
+func (s *Service) getCustomStatus(ctx context.Context, userID string) (*CustomStatus, error) {
+	payload, err := s.redis.GetCustomStatus(ctx, userID)
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load custom status: %w", err)
+	}
+	return decodeCustomStatus(payload), nil
+}
+
+// decodeCustomStatus parses a stored custom status; an empty or unreadable
+// payload is no status
+func decodeCustomStatus(payload string) *CustomStatus {
+	if payload == "" {
+		return nil
+	}
+
+	var status CustomStatus
+	if err := json.Unmarshal([]byte(payload), &status); err != nil {
+		return nil
+	}
+	return &status
+}
+
+// announceCustomStatus publishes a user's presence, as others see it, after
+// their custom status changed
+func (s *Service) announceCustomStatus(ctx context.Context, userID string) {
+	presence, err := s.GetPresence(ctx, "", userID)
+	if err != nil {
+		// The change is stored; subscribers see it at their next lookup
+		log.Printf("Failed to announce custom status of user %s: %v", userID, err)
+		return
+	}
+	s.publishPresence(ctx, presence)
+}
+
+// expireCustomStatus announces a custom status that cleared itself, if this
+// sweeper claims its expiry. Redis has already dropped the status; one
+// still present was replaced after the expiry was read.
+func (s *Service) expireCustomStatus(ctx context.Context, expiry redisclient.PresenceExpiry, now time.Time) error {
+	claimed, err := s.redis.ClaimCustomStatusExpiry(ctx, expiry.UserID, now)
+	if err != nil || !claimed {
+		return err
+	}
+
+	status, err := s.getCustomStatus(ctx, expiry.UserID)
+	if err != nil || status != nil {
+		return err
+	}
+
+	s.announceCustomStatus(ctx, expiry.UserID)
+	return nil
+}
+
+// setCustomStatusHandler handles setting the caller's custom status
+func (s *Service) setCustomStatusHandler(c *gin.Context) {
+	var req CustomStatus
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := s.SetCustomStatus(c.Request.Context(), identity.UserID(c), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// clearCustomStatusHandler handles clearing the caller's custom status
+func (s *Service) clearCustomStatusHandler(c *gin.Context) {
+	if err := s.ClearCustomStatus(c.Request.Context(), identity.UserID(c)); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -3,7 +3,9 @@ package redis
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"real-time-chat-system/internal/config"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -62,15 +64,45 @@ func (c *Client) Health(ctx context.Context) error {
 	return c.client.Ping(ctx).Err()
 }
 
-// Presence-related operations
-func (c *Client) SetPresence(ctx context.Context, userID string, status string, ttl time.Duration) error {
+// Presence-related operations. A user's presence is a hash of per-device
+// records under one key, so that every device of a user lives in the same
+// cluster slot. Each record carries its own expiry; the key itself expires
+// once the most recently refreshed device does.
+
+// swapDeviceScript stores one device's record, extends the key's expiry and
+// returns the fields the hash held beforehand
+var swapDeviceScript = redis.NewScript(`
+local previous = redis.call('HGETALL', KEYS[1])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return previous
+`)
+
+// SwapDevicePresence stores the presence record of one of a user's devices
+// and returns the user's device records as they were before
+func (c *Client) SwapDevicePresence(ctx context.Context, userID, deviceID, record string, ttl time.Duration) (map[string]string, error) {
 	key := fmt.Sprintf("presence:user:%s", userID)
-	return c.client.Set(ctx, key, status, ttl).Err()
+	fields, err := swapDeviceScript.Run(ctx, c.client, []string{key}, deviceID, record, ttl.Milliseconds()).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]string, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		previous[fields[i]] = fields[i+1]
+	}
+	return previous, nil
 }
 
-func (c *Client) GetPresence(ctx context.Context, userID string) (string, error) {
+// GetPresence returns a user's device records keyed by device ID
+func (c *Client) GetPresence(ctx context.Context, userID string) (map[string]string, error) {
 	key := fmt.Sprintf("presence:user:%s", userID)
-	return c.client.Get(ctx, key).Result()
+	return c.client.HGetAll(ctx, key).Result()
+}
+
+func (c *Client) RemoveDevicePresence(ctx context.Context, userID string, deviceIDs ...string) error {
+	key := fmt.Sprintf("presence:user:%s", userID)
+	return c.client.HDel(ctx, key, deviceIDs...).Err()
 }
 
 func (c *Client) DeletePresence(ctx context.Context, userID string) error {
@@ -78,11 +110,227 @@ func (c *Client) DeletePresence(ctx context.Context, userID string) error {
 	return c.client.Del(ctx, key).Err()
 }
 
-// Channel presence operations
+// SetLastSeen records when a user was last visibly active. It outlives the
+// presence key so that offline users can still report a last_seen time.
+func (c *Client) SetLastSeen(ctx context.Context, userID string, lastSeen time.Time, ttl time.Duration) error {
+	key := fmt.Sprintf("presence:lastseen:%s", userID)
+	return c.client.Set(ctx, key, lastSeen.UnixMilli(), ttl).Err()
+}
+
+func (c *Client) GetLastSeen(ctx context.Context, userID string) (time.Time, error) {
+	key := fmt.Sprintf("presence:lastseen:%s", userID)
+	millis, err := c.client.Get(ctx, key).Int64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(millis), nil
+}
+
+// SetCustomStatus stores a user's custom status; a zero ttl keeps it until
+// it is cleared
+func (c *Client) SetCustomStatus(ctx context.Context, userID string, status string, ttl time.Duration) error {
+	key := fmt.Sprintf("presence:custom:%s", userID)
+	return c.client.Set(ctx, key, status, ttl).Err()
+}
+
+func (c *Client) GetCustomStatus(ctx context.Context, userID string) (string, error) {
+	key := fmt.Sprintf("presence:custom:%s", userID)
+	return c.client.Get(ctx, key).Result()
+}
+
+// DeleteCustomStatus clears a user's custom status, reporting whether they
+// had one
+func (c *Client) DeleteCustomStatus(ctx context.Context, userID string) (bool, error) {
+	key := fmt.Sprintf("presence:custom:%s", userID)
+	deleted, err := c.client.Del(ctx, key).Result()
+	return deleted > 0, err
+}
+
+// Presence expiry tracking. Device records and custom statuses lapse
+// silently, so the time each user's next one runs out is indexed in a
+// sorted set that a sweeper polls to announce the resulting changes.
+const (
+	presenceExpiriesKey     = "presence:expiries"
+	customStatusExpiriesKey = "presence:custom-expiries"
+)
+
+// claimExpiryScript removes a user from an expiry index only if their entry
+// is still due, so a heartbeat or update that moved it in the meantime wins
+// and only one sweeper claims each expiry
+var claimExpiryScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+	return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// PresenceExpiry is a user whose presence was due to change at At
+type PresenceExpiry struct {
+	UserID string
+	At     time.Time
+}
+
+func (c *Client) TrackPresenceExpiry(ctx context.Context, userID string, expiresAt time.Time) error {
+	return c.trackExpiry(ctx, presenceExpiriesKey, userID, expiresAt)
+}
+
+func (c *Client) UntrackPresenceExpiry(ctx context.Context, userID string) error {
+	return c.client.ZRem(ctx, presenceExpiriesKey, userID).Err()
+}
+
+// DuePresenceExpiries returns up to limit users whose presence was due to
+// change by now
+func (c *Client) DuePresenceExpiries(ctx context.Context, now time.Time, limit int) ([]PresenceExpiry, error) {
+	return c.dueExpiries(ctx, presenceExpiriesKey, now, limit)
+}
+
+// ClaimPresenceExpiry removes a due user from the expiry index, reporting
+// whether this caller was the one to do so
+func (c *Client) ClaimPresenceExpiry(ctx context.Context, userID string, now time.Time) (bool, error) {
+	return c.claimExpiry(ctx, presenceExpiriesKey, userID, now)
+}
+
+func (c *Client) TrackCustomStatusExpiry(ctx context.Context, userID string, expiresAt time.Time) error {
+	return c.trackExpiry(ctx, customStatusExpiriesKey, userID, expiresAt)
+}
+
+func (c *Client) UntrackCustomStatusExpiry(ctx context.Context, userID string) error {
+	return c.client.ZRem(ctx, customStatusExpiriesKey, userID).Err()
+}
+
+// DueCustomStatusExpiries returns up to limit users whose custom status was
+// due to expire by now
+func (c *Client) DueCustomStatusExpiries(ctx context.Context, now time.Time, limit int) ([]PresenceExpiry, error) {
+	return c.dueExpiries(ctx, customStatusExpiriesKey, now, limit)
+}
+
+// ClaimCustomStatusExpiry removes a due user from the custom status expiry
+// index, reporting whether this caller was the one to do so
+func (c *Client) ClaimCustomStatusExpiry(ctx context.Context, userID string, now time.Time) (bool, error) {
+	return c.claimExpiry(ctx, customStatusExpiriesKey, userID, now)
+}
+
+func (c *Client) trackExpiry(ctx context.Context, key, userID string, expiresAt time.Time) error {
+	return c.client.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.UnixMilli()), Member: userID}).Err()
+}
+
+func (c *Client) dueExpiries(ctx context.Context, key string, now time.Time, limit int) ([]PresenceExpiry, error) {
+	due, err := c.client.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	expiries := make([]PresenceExpiry, 0, len(due))
+	for _, z := range due {
+		userID, ok := z.Member.(string)
+		if !ok {
+			continue
+		}
+		expiries = append(expiries, PresenceExpiry{UserID: userID, At: time.UnixMilli(int64(z.Score))})
+	}
+	return expiries, nil
+}
+
+func (c *Client) claimExpiry(ctx context.Context, key, userID string, now time.Time) (bool, error) {
+	removed, err := claimExpiryScript.Run(ctx, c.client, []string{key}, userID, now.UnixMilli()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return removed == 1, nil
+}
+
+// PresenceEntry is a user's stored device records, last-seen time and custom
+// status, as read by GetPresenceBatch. Devices is empty once the presence
+// key has expired, LastSeen is zero if none was recorded and CustomStatus is
+// empty if the user has none.
+type PresenceEntry struct {
+	Devices      map[string]string
+	LastSeen     time.Time
+	CustomStatus string
+}
+
+// GetPresenceBatch reads the presence, last-seen and custom status keys of
+// many users in a single pipeline. It issues one command per key rather than an MGET because
+// the keys hash to different slots when Redis runs as a cluster; the cluster
+// client splits the pipeline by node.
+func (c *Client) GetPresenceBatch(ctx context.Context, userIDs []string) ([]PresenceEntry, error) {
+	devices := make([]*redis.MapStringStringCmd, len(userIDs))
+	lastSeen := make([]*redis.StringCmd, len(userIDs))
+	customStatus := make([]*redis.StringCmd, len(userIDs))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, userID := range userIDs {
+			devices[i] = pipe.HGetAll(ctx, fmt.Sprintf("presence:user:%s", userID))
+			lastSeen[i] = pipe.Get(ctx, fmt.Sprintf("presence:lastseen:%s", userID))
+			customStatus[i] = pipe.Get(ctx, fmt.Sprintf("presence:custom:%s", userID))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	entries := make([]PresenceEntry, len(userIDs))
+	for i := range userIDs {
+		records, err := devices[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Devices = records
+
+		millis, err := lastSeen[i].Int64()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		if err == nil {
+			entries[i].LastSeen = time.UnixMilli(millis)
+		}
+
+		status, err := customStatus[i].Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		entries[i].CustomStatus = status
+	}
+
+	return entries, nil
+}
+
+// Channel presence operations. Each channel's sorted set is scored by when
+// each member was last seen connected, and every channel with a set is
+// listed in presenceChannelsKey so that stale members can be swept.
+const presenceChannelsKey = "presence:channels"
+
 func (c *Client) AddToChannelPresence(ctx context.Context, channelID, userID string) error {
-	key := fmt.Sprintf("presence:channel:%s", channelID)
+	return c.RefreshChannelPresence(ctx, map[string][]string{channelID: {userID}})
+}
+
+// RefreshChannelPresence marks users as present now, keyed by channel ID,
+// in a single pipeline
+func (c *Client) RefreshChannelPresence(ctx context.Context, members map[string][]string) error {
+	if len(members) == 0 {
+		return nil
+	}
+
 	score := float64(time.Now().Unix())
-	return c.client.ZAdd(ctx, key, redis.Z{Score: score, Member: userID}).Err()
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		channelIDs := make([]interface{}, 0, len(members))
+		for channelID, userIDs := range members {
+			present := make([]redis.Z, len(userIDs))
+			for i, userID := range userIDs {
+				present[i] = redis.Z{Score: score, Member: userID}
+			}
+			pipe.ZAdd(ctx, fmt.Sprintf("presence:channel:%s", channelID), present...)
+			channelIDs = append(channelIDs, channelID)
+		}
+		pipe.SAdd(ctx, presenceChannelsKey, channelIDs...)
+		return nil
+	})
+	return err
 }
 
 func (c *Client) RemoveFromChannelPresence(ctx context.Context, channelID, userID string) error {
@@ -90,9 +338,72 @@ func (c *Client) RemoveFromChannelPresence(ctx context.Context, channelID, userI
 	return c.client.ZRem(ctx, key, userID).Err()
 }
 
-func (c *Client) GetChannelPresence(ctx context.Context, channelID string) ([]string, error) {
+// GetChannelPresence returns every member of a channel seen since the given
+// time
+func (c *Client) GetChannelPresence(ctx context.Context, channelID string, since time.Time) ([]string, error) {
 	key := fmt.Sprintf("presence:channel:%s", channelID)
-	return c.client.ZRange(ctx, key, 0, -1).Result()
+	return c.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+}
+
+// GetChannelPresencePage returns a page of the members of a channel seen
+// since the given time, most recently seen first, along with how many such
+// members there are in total
+func (c *Client) GetChannelPresencePage(ctx context.Context, channelID string, since time.Time, offset, limit int) ([]string, int64, error) {
+	key := fmt.Sprintf("presence:channel:%s", channelID)
+	minScore := strconv.FormatInt(since.Unix(), 10)
+
+	var page *redis.StringSliceCmd
+	var total *redis.IntCmd
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		page = pipe.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+			Min:    minScore,
+			Max:    "+inf",
+			Offset: int64(offset),
+			Count:  int64(limit),
+		})
+		total = pipe.ZCount(ctx, key, minScore, "+inf")
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page.Val(), total.Val(), nil
+}
+
+// PruneChannelPresence removes members not seen since cutoff from every
+// channel's presence set, and forgets channels left empty. It returns how
+// many members were removed.
+func (c *Client) PruneChannelPresence(ctx context.Context, cutoff time.Time) (int64, error) {
+	maxScore := "(" + strconv.FormatInt(cutoff.Unix(), 10)
+
+	var removed int64
+	iter := c.client.SScan(ctx, presenceChannelsKey, 0, "", 100).Iterator()
+	for iter.Next(ctx) {
+		channelID := iter.Val()
+		key := fmt.Sprintf("presence:channel:%s", channelID)
+
+		count, err := c.client.ZRemRangeByScore(ctx, key, "-inf", maxScore).Result()
+		if err != nil {
+			return removed, err
+		}
+		removed += count
+
+		// Members are refreshed often, so a channel dropped here while a
+		// refresh raced the check is listed again by the next one
+		remaining, err := c.client.ZCard(ctx, key).Result()
+		if err != nil {
+			return removed, err
+		}
+		if remaining == 0 {
+			if err := c.client.SRem(ctx, presenceChannelsKey, channelID).Err(); err != nil {
+				return removed, err
+			}
+		}
+	}
+	return removed, iter.Err()
 }
 
 // Pub/Sub operations
@@ -105,21 +416,81 @@ func (c *Client) Subscribe(ctx context.Context, channles ...string) *redis.PubSu
 }
 
 // Rate limiting operations
-func (c *Client) IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error) {
-	pipe := c.client.Pipeline()
 
-	// Increment counter
-	incr := pipe.Incr(ctx, key)
+// incrementScript increments a fixed-window counter and starts its expiry on
+// the first hit only, so a busy key still expires at the end of its window.
+// Keys left without a TTL are given one again.
+var incrementScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 or redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func (c *Client) IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return incrementScript.Run(ctx, c.client, []string{key}, window.Milliseconds()).Int64()
+}
 
-	// Set expiration if this is the first increment
-	pipe.Expire(ctx, key, window)
+// slidingWindowScript atomically records a request in a sorted-set sliding
+// window if the limit allows it. Redis server time is used so that every
+// gateway node agrees on the window. It returns {allowed, remaining, reset_ms}
+// where reset_ms is the time until the oldest request leaves the window.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, time[1] .. time[2] .. ':' .. ARGV[3])
+	redis.call('PEXPIRE', key, window)
+	count = count + 1
+	allowed = 1
+end
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+
+return {allowed, limit - count, reset}
+`)
+
+// RateLimitResult describes the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until the oldest counted request leaves the
+	// window, which is also how long a rejected caller must wait
+	ResetAfter time.Duration
+}
 
-	_, err := pipe.Exec(ctx)
+// AllowRequest applies a sliding-window rate limit to key, counting the
+// request only if it is allowed
+func (c *Client) AllowRequest(ctx context.Context, key string, limit int, window time.Duration) (*RateLimitResult, error) {
+	nonce := strconv.FormatInt(rand.Int63(), 36)
+	values, err := slidingWindowScript.Run(ctx, c.client, []string{key}, window.Milliseconds(), limit, nonce).Int64Slice()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if len(values) != 3 {
+		return nil, fmt.Errorf("unexpected rate limit script result: %v", values)
 	}
 
-	return incr.Val(), nil
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  int(values[1]),
+		ResetAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
 }
 
 // Caching operations
@@ -127,10 +498,19 @@ func (c *Client) Set(ctx context.Context, key string, value interface{}, expirat
 	return c.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetNX sets key only if it does not exist, reporting whether it was set
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, value, expiration).Result()
+}
+
 func (c *Client) Get(ctx context.Context, key string) (string, error) {
 	return c.client.Get(ctx, key).Result()
 }
 
+func (c *Client) GetDel(ctx context.Context, key string) (string, error) {
+	return c.client.GetDel(ctx, key).Result()
+}
+
 func (c *Client) Del(ctx context.Context, keys ...string) error {
 	return c.client.Del(ctx, keys...).Err()
 }
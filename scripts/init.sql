@@ -42,7 +42,110 @@ CREATE TABLE IF NOT EXISTS messages (
     message_type VARCHAR(50) NOT NULL DEFAULT 'text',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    idempotency_key VARCHAR(255) UNIQUE
+    idempotency_key VARCHAR(255) UNIQUE,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    deleted_by UUID REFERENCES users(id),
+    parent_id UUID REFERENCES messages(id),
+    reply_count INTEGER NOT NULL DEFAULT 0,
+    last_reply_at TIMESTAMP WITH TIME ZONE,
+    also_sent_to_channel BOOLEAN NOT NULL DEFAULT FALSE,
+    content_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', content)) STORED
+);
+
+-- Create message revisions table (previous versions of edited messages)
+CREATE TABLE IF NOT EXISTS message_revisions (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    edited_by UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    replaced_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (message_id, revision)
+);
+
+-- Create message reactions table
+CREATE TABLE IF NOT EXISTS message_reactions (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, emoji)
+);
+
+-- Create channel read states table (per-user read watermarks)
+CREATE TABLE IF NOT EXISTS channel_read_states (
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id UUID NOT NULL,
+    last_read_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (channel_id, user_id)
+);
+
+-- Create user channels table (memberships indexed by user on the user's shard;
+-- channel_id has no foreign key because the channel may live on another shard)
+CREATE TABLE IF NOT EXISTS user_channels (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel_id UUID NOT NULL,
+    muted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, channel_id)
+);
+
+-- Create message mentions table (mentions indexed by the mentioned user on
+-- their shard; message_id and channel_id have no foreign keys because the
+-- message may live on another shard)
+CREATE TABLE IF NOT EXISTS message_mentions (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL,
+    channel_id UUID NOT NULL,
+    mentioned_by UUID NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, message_id)
+);
+
+-- Create attachment uploads table (resumable uploads still in progress)
+CREATE TABLE IF NOT EXISTS attachment_uploads (
+    id UUID PRIMARY KEY,
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    size BIGINT NOT NULL,
+    received BIGINT NOT NULL DEFAULT 0,
+    parts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Create message attachments table (message_id is NULL until the attachment is sent)
+CREATE TABLE IF NOT EXISTS message_attachments (
+    id UUID PRIMARY KEY,
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    message_id UUID REFERENCES messages(id) ON DELETE CASCADE,
+    uploaded_by UUID NOT NULL REFERENCES users(id),
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    blurhash VARCHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create attachment thumbnails table (scaled-down copies of image attachments)
+CREATE TABLE IF NOT EXISTS attachment_thumbnails (
+    attachment_id UUID NOT NULL REFERENCES message_attachments(id) ON DELETE CASCADE,
+    max_edge INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    PRIMARY KEY (attachment_id, max_edge)
 );
 
 -- Create call sessions table
@@ -62,15 +165,23 @@ CREATE TABLE IF NOT EXISTS call_participants (
     user_id UUID NOT NULL REFERENCES users(id),
     joined_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     left_at TIMESTAMP WITH TIME ZONE,
-    signaling_state VARCHAR(50) DEFAULT 'joining',
+    signalling_state VARCHAR(50) DEFAULT 'joining',
     PRIMARY KEY (call_id, user_id)
 );
 
 -- Create indexes for performance
 CREATE INDEX IF NOT EXISTS idx_messages_channel_created ON messages(channel_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_messages_idempotency ON messages(idempotency_key) WHERE idempotency_key IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_parent_created ON messages(parent_id, created_at) WHERE parent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_message_reactions_message ON message_reactions(message_id, emoji);
+CREATE INDEX IF NOT EXISTS idx_messages_content_tsv ON messages USING GIN (content_tsv);
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user_created ON message_mentions(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_message_attachments_message ON message_attachments(message_id) WHERE message_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_attachment_uploads_expires ON attachment_uploads(expires_at);
+CREATE INDEX IF NOT EXISTS idx_messages_deleted ON messages(deleted_at) WHERE deleted_at IS NOT NULL;
 CREATE INDEX IF NOT EXISTS idx_channel_members_user ON channel_members(user_id);
 CREATE INDEX IF NOT EXISTS idx_call_sessions_channel ON call_sessions(channel_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_call_sessions_active_channel ON call_sessions(channel_id) WHERE status = 'active';
 CREATE INDEX IF NOT EXISTS idx_call_participants_user ON call_participants(user_id);
 
 -- Insert some sample data for development
@@ -91,4 +202,8 @@ INSERT INTO channel_members (channel_id, user_id, role) VALUES
     ('660e8400-e29b-41d4-a716-446655440000', '550e8400-e29b-41d4-a716-446655440002', 'member'),
     ('660e8400-e29b-41d4-a716-446655440001', '550e8400-e29b-41d4-a716-446655440000', 'admin'),
     ('660e8400-e29b-41d4-a716-446655440001', '550e8400-e29b-41d4-a716-446655440001', 'member')
-ON CONFLICT (channel_id, user_id) DO NOTHING;
\ No newline at end of file
+ON CONFLICT (channel_id, user_id) DO NOTHING;
+
+INSERT INTO user_channels (user_id, channel_id)
+SELECT user_id, channel_id FROM channel_members
+ON CONFLICT (user_id, channel_id) DO NOTHING;
\ No newline at end of file
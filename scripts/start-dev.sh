@@ -85,6 +85,12 @@ CALL_PORT=:8083 ./bin/call-service > logs/call.log 2>&1 &
 CALL_PID=$!
 echo $CALL_PID > pids/call.pid
 
+# Start Auth Service
+print_status "Starting Auth Service on :8084..."
+AUTH_PORT=:8084 ./bin/auth-service > logs/auth.log 2>&1 &
+AUTH_PID=$!
+echo $AUTH_PID > pids/auth.pid
+
 # Wait a moment for services to start
 sleep 3
 
@@ -116,6 +122,7 @@ check_service "API Gateway" "8080"
 check_service "Chat Service" "8081"
 check_service "Presence Service" "8082"
 check_service "Call Service" "8083"
+check_service "Auth Service" "8084"
 
 # Step 5: Display service information
 print_header "Development environment is ready!"
@@ -126,12 +133,14 @@ echo "  • API Gateway:     http://localhost:8080"
 echo "  • Chat Service:    http://localhost:8081"
 echo "  • Presence Service: http://localhost:8082"
 echo "  • Call Service:    http://localhost:8083"
+echo "  • Auth Service:    http://localhost:8084"
 echo ""
 echo "🔍 Health Endpoints:"
 echo "  • Gateway Health:  http://localhost:8080/health"
 echo "  • Chat Health:     http://localhost:8081/health"
 echo "  • Presence Health: http://localhost:8082/health"
 echo "  • Call Health:     http://localhost:8083/health"
+echo "  • Auth Health:     http://localhost:8084/health"
 echo ""
 echo "📊 Infrastructure:"
 echo "  • PostgreSQL:      localhost:5432 (user: postgres, db: chatplatform)"
@@ -142,6 +151,7 @@ echo "  • Gateway:         tail -f logs/gateway.log"
 echo "  • Chat:            tail -f logs/chat.log"
 echo "  • Presence:        tail -f logs/presence.log"
 echo "  • Call:            tail -f logs/call.log"
+echo "  • Auth:            tail -f logs/auth.log"
 echo ""
 echo "🛑 To stop all services: ./scripts/stop-dev.sh"
 echo ""
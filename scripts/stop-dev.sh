@@ -50,6 +50,7 @@ stop_service "gateway"
 stop_service "chat"
 stop_service "presence"
 stop_service "call"
+stop_service "auth"
 
 # Stop Docker services
 print_status "Stopping Docker services..."